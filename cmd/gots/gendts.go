@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/discoverkl/gots"
+	"github.com/discoverkl/gots/code"
+	"github.com/discoverkl/gots/ui"
+)
+
+// genDTS writes typescript declarations of the code api.
+//
+// usage: gots gen-dts [-o file]
+func genDTS(args []string) error {
+	flags := flag.NewFlagSet("gen-dts", flag.ExitOnError)
+	out := flags.String("o", "", "output file (default: stdout)")
+	flags.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	app := code.UI(gots.Source)
+	return ui.WriteDTS(w, app.GetBindings())
+}
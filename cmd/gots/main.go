@@ -15,6 +15,13 @@ func main() {
 
 	flag.Parse()
 
+	if flag.Arg(0) == "gen-dts" {
+		if err := genDTS(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if flag.NArg() > 0 {
 		path = flag.Arg(0)
 	}
@@ -1,11 +1,28 @@
 
 interface Base {
   context: Context
+  Gots: Gots
   [propName: string]: any
 }
 
+interface GotsError extends Error {
+  code: string
+  details?: any
+  goStack?: string
+}
+
+interface Gots {
+  Error: new (e: { code: string; message: string; details?: any }) => GotsError
+  on(topic: string, handler: (payload: any) => void): () => void
+  off(topic: string, handler?: (payload: any) => void): void
+  expose(name: string, fn: (...args: any[]) => any): () => void
+  unexpose(name: string): void
+}
+
 interface Context {
   withCancel(): [any, CancelFunc]
+  withTimeout(ms: number): [any, CancelFunc]
+  withDeadline(deadline: Date | number): [any, CancelFunc]
 }
 
 interface CancelFunc {
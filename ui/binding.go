@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
 	"strings"
 	"unicode"
@@ -9,6 +10,59 @@ import (
 
 type BindingFunc interface{}
 
+// Optional marks a parameter type as optional when embedded in it,
+// a missing trailing argument is the zero value.
+// Pointer and context.Context parameters are always optional.
+type Optional struct{}
+
+func (Optional) gotsOptional() {}
+
+type optionalMarker interface{ gotsOptional() }
+
+var optionalType = reflect.TypeOf((*optionalMarker)(nil)).Elem()
+
+func isOptional(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr || t == ctxType || t.Implements(optionalType)
+}
+
+var (
+	uiContextType = reflect.TypeOf((*UIContext)(nil))
+	requestType   = reflect.TypeOf((*http.Request)(nil))
+	sessionType   = reflect.TypeOf((*Session)(nil))
+)
+
+// isInjected reports whether a parameter is filled by server instead of javascript arguments.
+func isInjected(t reflect.Type) bool {
+	return t == uiContextType || t == requestType || t == sessionType
+}
+
+// jsParams lists indexes of fixed parameters which come from javascript arguments.
+func jsParams(fn reflect.Type) []int {
+	ret := []int{}
+	for i := 0; i < numFixedIn(fn); i++ {
+		if !isInjected(fn.In(i)) {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// numFixedIn is the number of parameters without the variadic one.
+func numFixedIn(fn reflect.Type) int {
+	if fn.IsVariadic() {
+		return fn.NumIn() - 1
+	}
+	return fn.NumIn()
+}
+
+// paramType is the type of the i-th argument, arguments after fixed ones are variadic.
+func paramType(fn reflect.Type, i int) reflect.Type {
+	if n := numFixedIn(fn); i >= n {
+		return fn.In(n).Elem()
+	}
+	return fn.In(i)
+}
+
 // Bindings represent an api.
 // Every binding has a name and a callable object.
 type Bindings interface {
@@ -69,7 +123,7 @@ func DelayMap(prototype map[string]interface{}, factory func(*UIContext) Binding
 	if len(names) == 0 {
 		return &mapBinding{err: fmt.Errorf("bind delay map: names is empty")}
 	}
-	return &mapBinding{names: names, factory: factory}
+	return &mapBinding{names: names, factory: factory, prototype: binds.(*mapBinding).binds}
 }
 
 func DelayObject(prototype interface{}, factory func(*UIContext) Bindings) Bindings {
@@ -81,7 +135,7 @@ func DelayObject(prototype interface{}, factory func(*UIContext) Bindings) Bindi
 	if len(names) == 0 {
 		return &mapBinding{err: fmt.Errorf("bind delay object: names is empty")}
 	}
-	return &mapBinding{names: names, factory: factory}
+	return &mapBinding{names: names, factory: factory, prototype: binds.(*mapBinding).binds}
 }
 
 //
@@ -89,10 +143,11 @@ func DelayObject(prototype interface{}, factory func(*UIContext) Bindings) Bindi
 //
 
 type mapBinding struct {
-	names   []string
-	binds   map[string]BindingFunc
-	factory func(*UIContext) Bindings
-	err     error
+	names     []string
+	binds     map[string]BindingFunc
+	factory   func(*UIContext) Bindings
+	prototype map[string]BindingFunc // signatures of a delayed binding, if known
+	err       error
 }
 
 func bindingItem(name string, fn interface{}) *mapBinding {
@@ -122,13 +177,49 @@ func (m *mapBinding) Map(c *UIContext) map[string]BindingFunc {
 	if m.factory == nil {
 		return nil
 	}
-	return m.factory(c).Map(nil)
+	binds := m.factory(c)
+	policies := getPolicies(binds)
+	if len(policies) == 0 {
+		return binds.Map(nil)
+	}
+	// policies of a factory result are unknown at Bind time, they run here
+	ret := map[string]BindingFunc{}
+	for name, f := range binds.Map(nil) {
+		if p := policies[name]; len(p) > 0 && (c == nil || authorize(p, c) != nil) {
+			continue
+		}
+		ret[name] = f
+	}
+	return ret
 }
 
 func (m *mapBinding) Error() error {
 	return m.err
 }
 
+// binds -> prototype
+func (m *mapBinding) prototypes() map[string]BindingFunc {
+	if m.binds != nil {
+		return m.binds
+	}
+	return m.prototype
+}
+
+// prototyper is implemented by bindings which can tell their function signatures
+// without creating a session.
+type prototyper interface {
+	prototypes() map[string]BindingFunc
+}
+
+// getPrototypes returns known function signatures of b by binding name.
+// Names without a known signature are missing from the result.
+func getPrototypes(b Bindings) map[string]BindingFunc {
+	if p, ok := b.(prototyper); ok {
+		return p.prototypes()
+	}
+	return nil
+}
+
 type member struct {
 	Name  string
 	Value reflect.Value
@@ -222,6 +313,22 @@ func (p *prefixBinding) Names() []string {
 	return ret
 }
 
+func (p *prefixBinding) prototypes() map[string]BindingFunc {
+	ret := map[string]BindingFunc{}
+	for name, fn := range getPrototypes(p.Bindings) {
+		ret[fmt.Sprintf("%s.%s", p.prefix, name)] = fn
+	}
+	return ret
+}
+
+func (p *prefixBinding) policies() map[string][]Policy {
+	ret := map[string][]Policy{}
+	for name, policies := range getPolicies(p.Bindings) {
+		ret[fmt.Sprintf("%s.%s", p.prefix, name)] = policies
+	}
+	return ret
+}
+
 func (p *prefixBinding) Map(c *UIContext) map[string]BindingFunc {
 	binds := p.Bindings.Map(c)
 	ret := map[string]BindingFunc{}
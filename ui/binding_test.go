@@ -141,3 +141,36 @@ func check(binds Bindings) error {
 	}
 	return nil
 }
+
+func TestRequire(t *testing.T) {
+	deny := func(c *UIContext) error { return fmt.Errorf("denied") }
+	allow := func(c *UIContext) error { return nil }
+
+	assertValid(t, Require(allow, Object(&someAPI{})))
+	assertNotValid(t, Require(deny, Object(&someAPI{})))
+	assertNotValid(t, Require(nil, Object(&someAPI{})))
+
+	binds := Prefix("admin", Require(deny, Func("sum", sum)))
+	policies := getPolicies(binds)
+	if len(policies["admin.sum"]) != 1 {
+		t.Fatalf("policies = %v", policies)
+	}
+	err := authorize(policies["admin.sum"], &UIContext{})
+	if e, ok := err.(*Error); !ok || e.Code != CodePermissionDenied {
+		t.Errorf("authorize = %v", err)
+	}
+
+	// a policy returned by a factory runs for the session
+	delayed := func(policy Policy) Bindings {
+		return Delay([]string{"sum"}, func(*UIContext) Bindings { return Require(policy, Func("sum", sum)) })
+	}
+	if m := delayed(deny).Map(&UIContext{}); len(m) != 0 {
+		t.Errorf("denied delay bindings = %v", m)
+	}
+	if m := delayed(allow).Map(&UIContext{}); m["sum"] == nil {
+		t.Errorf("allowed delay bindings = %v", m)
+	}
+	if m := delayed(allow).Map(nil); len(m) != 0 {
+		t.Errorf("delay bindings without a session = %v", m)
+	}
+}
@@ -0,0 +1,197 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+)
+
+// Top-level []byte and io.Reader arguments and results of bindings are sent as binary frames
+// with FeatureBinary, and referenced from the json message by a blobRef.
+//
+// A binary frame is a chunk of a blob: 4 bytes blob id, 1 byte final flag, then the data.
+
+const (
+	blobChunkSize = 1 << 20
+	blobHeaderLen = 5
+)
+
+// maxBlobBytes limits received blob bytes a connection holds until calls take them,
+// a client which sends more is disconnected.
+var maxBlobBytes = 64 << 20
+
+var (
+	bytesType  = reflect.TypeOf([]byte(nil))
+	readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+)
+
+// blobRef replaces a blob in a json message.
+type blobRef struct {
+	ID   int    `json:"$blob"`
+	Type string `json:"type,omitempty"` // "bytes" for Uint8Array or "blob" for Blob
+}
+
+// parseBlobRef reports whether raw is a blobRef.
+func parseBlobRef(raw json.RawMessage) (blobRef, bool) {
+	ref := blobRef{ID: -1}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' || !bytes.Contains(raw, []byte(`"$blob"`)) {
+		return ref, false
+	}
+	if err := json.Unmarshal(raw, &ref); err != nil || ref.ID < 0 {
+		return ref, false
+	}
+	return ref, true
+}
+
+// isBlobType reports whether a parameter can be received as a blob.
+func isBlobType(t reflect.Type) bool {
+	return t == bytesType || t == readerType
+}
+
+// putChunk collects a received blob chunk.
+func (p *jsClient) putChunk(data []byte) error {
+	if len(data) < blobHeaderLen {
+		return fmt.Errorf("bad blob chunk of %d bytes", len(data))
+	}
+	id := int(binary.BigEndian.Uint32(data))
+	final := data[4] == 1
+	chunk := data[blobHeaderLen:]
+	p.Lock()
+	defer p.Unlock()
+	if p.blobBytes+len(chunk) > maxBlobBytes {
+		return fmt.Errorf("received blobs exceed %d bytes", maxBlobBytes)
+	}
+	p.blobBytes += len(chunk)
+	p.blobs[id] = append(p.blobs[id], chunk...)
+	if final {
+		p.received[id] = true
+	}
+	return nil
+}
+
+// takeBlob removes a received blob.
+func (p *jsClient) takeBlob(id int) ([]byte, bool) {
+	p.Lock()
+	defer p.Unlock()
+	data, ok := p.blobs[id]
+	if !ok || !p.received[id] {
+		return nil, false
+	}
+	p.deleteBlob(id)
+	if data == nil {
+		data = []byte{}
+	}
+	return data, true
+}
+
+// deleteBlob forgets a blob, the caller holds the lock.
+func (p *jsClient) deleteBlob(id int) {
+	p.blobBytes -= len(p.blobs[id])
+	delete(p.blobs, id)
+	delete(p.received, id)
+}
+
+// dropBlobs discards blobs referenced by arguments of a call which are not taken by the binding,
+// like a blob of a rejected call or of a non-[]byte parameter.
+func (p *jsClient) dropBlobs(args []json.RawMessage) {
+	p.Lock()
+	defer p.Unlock()
+	for _, raw := range args {
+		if ref, ok := parseBlobRef(raw); ok {
+			p.deleteBlob(ref.ID)
+		}
+	}
+}
+
+// sendBlob sends data as binary frames, it returns the blob id.
+func (p *jsClient) sendBlob(data []byte) (int, error) {
+	id := int(atomic.AddInt32(&p.blobID, 1))
+	for off := 0; ; off += blobChunkSize {
+		end := off + blobChunkSize
+		final := end >= len(data)
+		if final {
+			end = len(data)
+		}
+		chunk := make([]byte, blobHeaderLen+end-off)
+		binary.BigEndian.PutUint32(chunk, uint32(id))
+		if final {
+			chunk[4] = 1
+		}
+		copy(chunk[blobHeaderLen:], data[off:end])
+		if err := p.conn.WriteMessage(true, chunk); err != nil {
+			return 0, err
+		}
+		if final {
+			return id, nil
+		}
+	}
+}
+
+// blobArg decodes a []byte or io.Reader argument from a blob or json.
+func (p *jsClient) blobArg(t reflect.Type, raw json.RawMessage) (reflect.Value, error) {
+	var data []byte
+	if ref, ok := parseBlobRef(raw); ok {
+		blob, ok := p.takeBlob(ref.ID)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("blob %d is not received", ref.ID)
+		}
+		data = blob
+	} else if t == readerType {
+		// text or null without blob
+		var text *string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return reflect.Value{}, err
+		}
+		if text == nil {
+			return reflect.Zero(t), nil
+		}
+		data = []byte(*text)
+	} else if err := json.Unmarshal(raw, &data); err != nil {
+		return reflect.Value{}, err
+	}
+
+	if t == readerType {
+		return reflect.ValueOf(bytes.NewReader(data)), nil
+	}
+	return reflect.ValueOf(data), nil
+}
+
+// wireResult sends a []byte or io.Reader result as a blob.
+// Without FeatureBinary, readers are read into []byte which is base64 encoded in json.
+func (p *jsClient) wireResult(ret interface{}) (interface{}, error) {
+	var data []byte
+	typ := "bytes"
+	switch v := ret.(type) {
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		data = v
+	case io.Reader:
+		if c, ok := v.(io.Closer); ok {
+			defer c.Close()
+		}
+		b, err := io.ReadAll(v)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+		typ = "blob"
+	default:
+		return ret, nil
+	}
+
+	if !p.supports(FeatureBinary) {
+		return data, nil
+	}
+	id, err := p.sendBlob(data)
+	if err != nil {
+		return nil, err
+	}
+	return blobRef{ID: id, Type: typ}, nil
+}
@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBlobArg(t *testing.T) {
+	p := &jsClient{blobs: map[int][]byte{}, received: map[int]bool{}}
+	p.putChunk([]byte{0, 0, 0, 7, 0, 'h', 'e'})
+	p.putChunk([]byte{0, 0, 0, 7, 1, 'y'})
+
+	v, err := p.blobArg(readerType, json.RawMessage(`{"$blob": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(v.Interface().(io.Reader))
+	if string(data) != "hey" {
+		t.Errorf("blob = %q", data)
+	}
+	if _, err := p.blobArg(bytesType, json.RawMessage(`{"$blob": 7}`)); err == nil {
+		t.Errorf("blob is taken twice")
+	}
+
+	v, err = p.blobArg(bytesType, json.RawMessage(`"aGV5"`))
+	if err != nil || string(v.Bytes()) != "hey" {
+		t.Errorf("base64 = %q %v", v.Bytes(), err)
+	}
+	v, err = p.blobArg(readerType, json.RawMessage(`null`))
+	if err != nil || !v.IsNil() {
+		t.Errorf("null reader = %v %v", v, err)
+	}
+}
+
+func TestBlobDropped(t *testing.T) {
+	p, c := newPipePage(t, map[string]BindingFunc{
+		"sum":  func(a, b int) int { return a + b },
+		"size": func(data []byte) int { return len(data) },
+	})
+	chunk := func(id byte, data string) {
+		if err := c.conn.WriteMessage(true, append([]byte{0, 0, 0, id, 1}, data...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blobs := func() int {
+		p.jsc.Lock()
+		defer p.jsc.Unlock()
+		return len(p.jsc.blobs) + p.jsc.blobBytes
+	}
+
+	// a blob of an int parameter, too many arguments, a missing argument, an unknown binding, then a taken blob
+	for i, args := range [][]interface{}{
+		{h{"$blob": 1}, 2},
+		{h{"$blob": 2}, 1, 2},
+		{h{"$blob": 3}},
+	} {
+		chunk(byte(i+1), "data")
+		if v := c.call("sum", args...); v.Err() == nil {
+			t.Errorf("sum%v = %v", args, v.Int())
+		}
+	}
+	chunk(4, "data")
+	c.call("nope", h{"$blob": 4})
+	chunk(5, "data")
+	if v := c.call("size", h{"$blob": 5}); v.Int() != 4 {
+		t.Errorf("size = %v %v", v.Int(), v.Err())
+	}
+	if n := blobs(); n != 0 {
+		t.Errorf("%d blob bytes are left", n)
+	}
+}
+
+func TestBlobLimit(t *testing.T) {
+	defer func(n int) { maxBlobBytes = n }(maxBlobBytes)
+	maxBlobBytes = 8
+
+	p, c := newPipePage(t, map[string]BindingFunc{"sum": func(a, b int) int { return a + b }})
+	for i := 0; i < 3; i++ {
+		c.conn.WriteMessage(true, []byte{0, 0, 0, 1, 0, 'a', 'b', 'c', 'd'}) // never final
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("client sending too many blob bytes is not disconnected")
+	}
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"log"
@@ -91,8 +92,17 @@ func (c *browserPage) SetExitDelay(d time.Duration) {
 	c.server.localServerExitDelay = d
 }
 
+// Eval evaluates javascript in the latest connected page, it waits for a page if there is none yet.
 func (c *browserPage) Eval(js string) Value {
-	panic("Not Implemented")
+	return c.EvalContext(context.Background(), js)
+}
+
+func (c *browserPage) EvalContext(ctx context.Context, js string) Value {
+	sess, err := c.server.latestSession(ctx, c.done)
+	if err != nil {
+		return value{err: err}
+	}
+	return sess.EvalContext(ctx, js)
 }
 
 func (c *browserPage) Done() <-chan struct{} {
@@ -110,8 +120,6 @@ func (c *browserPage) Close() error {
 			log.Println("Window.server done")
 		}
 
-		c.Close()
-
 		// notify finally close
 		close(c.done)
 	})
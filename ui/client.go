@@ -0,0 +1,375 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Client plays gots.js on the other end of a Transport, so that bindings can be called from Go,
+// for example in tests without a browser:
+//
+//	server, conn := ui.Pipe()
+//	go s.ServeTransport(server, httptest.NewRequest("GET", "/gots", nil))
+//	c := ui.NewClient(conn)
+//	defer c.Close()
+//	if err := c.Ready(ctx); err != nil {
+//		...
+//	}
+//	v := c.Call(ctx, "sum", 1, 2)
+//
+// Arguments of Call are sent as json, except a *Callback which stands for a javascript function,
+// and a context.Context which stands for an AbortSignal: its deadline is sent and canceling it cancels the Go context.
+// Functions exposed by Expose answer Page.Call.
+//
+// Client speaks protocol version 1, it never sends Gots.hello so no optional feature is negotiated.
+// Channel results are refused by the server.
+type Client struct {
+	// Eval answers Page.Eval, nil replies an error.
+	Eval func(expr string) (interface{}, error)
+
+	conn Transport
+
+	mu        sync.Mutex
+	seq       int
+	calls     map[callKey]chan callRet
+	callbacks map[callKey]*Callback
+	exposed   map[string]ClientFunc
+	names     []string
+	ready     chan struct{}
+	isDone    bool
+	done      chan struct{}
+
+	unhandled chan msg // messages the client does not answer, used by tests
+}
+
+// ClientFunc is a Go function which is called by the server like a javascript function.
+type ClientFunc func(args []json.RawMessage) (interface{}, error)
+
+// Callback is passed to a binding in place of a javascript function, the binding gets a *Function.
+// A Callback can be passed to one call only.
+type Callback struct {
+	fn     ClientFunc
+	key    callKey
+	once   sync.Once
+	closed chan struct{}
+}
+
+// NewCallback wraps fn as a javascript function argument.
+func NewCallback(fn ClientFunc) *Callback {
+	return &Callback{fn: fn, closed: make(chan struct{})}
+}
+
+// Closed is closed when the server releases the callback, or the connection is closed.
+func (cb *Callback) Closed() <-chan struct{} {
+	return cb.closed
+}
+
+func (cb *Callback) close() {
+	cb.once.Do(func() { close(cb.closed) })
+}
+
+// callRet is the reply to a binding call.
+type callRet struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+	Stream bool            `json:"stream"`
+}
+
+// NewClient starts reading messages from conn, the server side is ServeTransport.
+func NewClient(conn Transport) *Client {
+	return newClient(conn, nil)
+}
+
+// newClient passes messages which are not handled to unhandled if it is not nil,
+// it is closed when the connection is closed.
+func newClient(conn Transport, unhandled chan msg) *Client {
+	c := &Client{
+		unhandled: unhandled,
+		conn:      conn,
+		calls:     map[callKey]chan callRet{},
+		callbacks: map[callKey]*Callback{},
+		exposed:   map[string]ClientFunc{},
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Ready waits until the bindings of the session are bound.
+func (c *Client) Ready(ctx context.Context) error {
+	select {
+	case <-c.ready:
+		return nil
+	case <-c.done:
+		return ErrDisconnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Names returns names bound so far.
+func (c *Client) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.names...)
+}
+
+// Expose makes fn callable by Page.Call(name, ...), like Gots.expose in javascript.
+func (c *Client) Expose(name string, fn ClientFunc) error {
+	c.mu.Lock()
+	c.exposed[name] = fn
+	c.mu.Unlock()
+	return c.write(h{"method": "Gots.expose", "params": h{"names": []string{name}}})
+}
+
+// Unexpose removes a function added by Expose.
+func (c *Client) Unexpose(name string) error {
+	c.mu.Lock()
+	delete(c.exposed, name)
+	c.mu.Unlock()
+	return c.write(h{"method": "Gots.unexpose", "params": h{"names": []string{name}}})
+}
+
+// Call invokes a binding and waits for its result, binding errors are *Error.
+func (c *Client) Call(ctx context.Context, name string, args ...interface{}) Value {
+	c.mu.Lock()
+	if c.isDone {
+		c.mu.Unlock()
+		return value{err: ErrDisconnected}
+	}
+	c.seq++
+	key := callKey{name: name, seq: c.seq}
+	retCh := make(chan callRet, 1)
+	c.calls[key] = retCh
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+	}()
+
+	wire, stop := c.wireArgs(name, args)
+	defer stop()
+	if err := c.write(h{"method": "Gots.call", "params": h{"name": name, "seq": key.seq, "args": wire}}); err != nil {
+		return value{err: err}
+	}
+	select {
+	case ret := <-retCh:
+		if ret.Error != nil {
+			return value{err: ret.Error}
+		}
+		if ret.Stream {
+			return value{err: fmt.Errorf("stream result of %s is not supported", name)}
+		}
+		return value{raw: ret.Result}
+	case <-c.done:
+		return value{err: ErrDisconnected}
+	case <-ctx.Done():
+		return value{err: ctx.Err()}
+	}
+}
+
+// wireArgs replaces callbacks and contexts of a call by their references.
+// stop ends watching the contexts when the call returns.
+func (c *Client) wireArgs(name string, args []interface{}) ([]interface{}, func()) {
+	wire := make([]interface{}, len(args))
+	stops := []func(){}
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case *Callback:
+			c.mu.Lock()
+			c.seq++
+			v.key = callKey{name: name, seq: c.seq}
+			c.callbacks[v.key] = v
+			c.mu.Unlock()
+			wire[i] = h{"bindingName": v.key.name, "seq": v.key.seq}
+		case context.Context:
+			c.mu.Lock()
+			c.seq++
+			seq := c.seq
+			c.mu.Unlock()
+			ref := h{"seq": seq}
+			if deadline, ok := v.Deadline(); ok {
+				ref["timeout"] = float64(time.Until(deadline)) / float64(time.Millisecond)
+			}
+			wire[i] = ref
+			stop := make(chan struct{})
+			stops = append(stops, func() { close(stop) })
+			go func() {
+				select {
+				case <-v.Done():
+					if v.Err() != context.DeadlineExceeded { // the server has its own timer
+						c.write(h{"method": "Gots.refCall", "params": h{"seq": seq}})
+					}
+				case <-stop:
+				}
+			}()
+		default:
+			wire[i] = arg
+		}
+	}
+	return wire, func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// Done is closed when the connection is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) write(m h) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(false, data)
+}
+
+// reply answers a request of the server.
+func (c *Client) reply(id int, result interface{}, err error) {
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+	}
+	c.write(h{"id": id, "method": "Gots.ret", "params": h{"result": result, "error": errText}})
+}
+
+// answer runs fn for a request of the server in its own goroutine, like an async javascript function.
+func (c *Client) answer(id int, fn ClientFunc, args []json.RawMessage) {
+	go func() {
+		result, err := fn(args)
+		c.reply(id, result, err)
+	}()
+}
+
+// unhandle passes a message to tests, or rejects a request which is not supported.
+func (c *Client) unhandle(m msg) {
+	if c.unhandled != nil {
+		c.unhandled <- m
+		return
+	}
+	if m.ID != 0 && (m.Method == "Gots.call" || m.Method == "Gots.callback") {
+		c.reply(m.ID, nil, fmt.Errorf("%s is not supported by Client", m.Method))
+	}
+}
+
+func (c *Client) readLoop() {
+	defer func() {
+		c.mu.Lock()
+		c.isDone = true
+		callbacks := c.callbacks
+		c.callbacks = map[callKey]*Callback{}
+		c.mu.Unlock()
+		for _, cb := range callbacks {
+			cb.close()
+		}
+		close(c.done)
+		c.conn.Close()
+		if c.unhandled != nil {
+			close(c.unhandled)
+		}
+	}()
+	for {
+		binary, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if binary {
+			continue // blobs and binary codecs are not negotiated
+		}
+		m := msg{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return
+		}
+		switch m.Method {
+		case "Gots.bind":
+			bind := struct {
+				Name []string `json:"name"`
+			}{}
+			json.Unmarshal(m.Params, &bind)
+			c.mu.Lock()
+			c.names = append(c.names, bind.Name...)
+			c.mu.Unlock()
+		case "Gots.ready":
+			select {
+			case <-c.ready:
+			default:
+				close(c.ready)
+			}
+		case "Gots.ret":
+			call := callParams{}
+			ret := callRet{}
+			json.Unmarshal(m.Params, &call)
+			json.Unmarshal(m.Params, &ret)
+			c.mu.Lock()
+			retCh, ok := c.calls[callKey{name: call.Name, seq: call.Seq}]
+			c.mu.Unlock()
+			if !ok {
+				c.unhandle(m)
+				break
+			}
+			retCh <- ret
+		case "Gots.callback", "Gots.closeCallback":
+			call := callParams{}
+			json.Unmarshal(m.Params, &call)
+			key := callKey{name: call.Name, seq: call.Seq}
+			c.mu.Lock()
+			cb, ok := c.callbacks[key]
+			if ok && m.Method == "Gots.closeCallback" {
+				delete(c.callbacks, key)
+			}
+			c.mu.Unlock()
+			switch {
+			case !ok:
+				c.unhandle(m)
+			case m.Method == "Gots.callback":
+				c.answer(m.ID, cb.fn, call.Args)
+			default:
+				cb.close()
+			}
+		case "Gots.call":
+			req := struct {
+				Name string            `json:"name"`
+				Path string            `json:"path"`
+				Args []json.RawMessage `json:"args"`
+			}{}
+			json.Unmarshal(m.Params, &req)
+			var fn ClientFunc
+			c.mu.Lock()
+			switch {
+			case req.Name == "call":
+				fn = c.exposed[req.Path]
+			case req.Name == "eval" && c.Eval != nil && len(req.Args) == 1:
+				fn = func(args []json.RawMessage) (interface{}, error) {
+					var expr string
+					json.Unmarshal(args[0], &expr)
+					return c.Eval(expr)
+				}
+			}
+			c.mu.Unlock()
+			if fn == nil {
+				c.unhandle(m)
+				break
+			}
+			c.answer(m.ID, fn, req.Args)
+		case "Gots.ping":
+			c.reply(m.ID, nil, nil)
+		case "Gots.close":
+			return
+		default:
+			c.unhandle(m)
+		}
+	}
+}
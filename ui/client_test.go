@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	s.Bind(Func("sum", sum))
+	s.Bind(Func("find", func(id int) (string, error) { return "", NewError(CodeNotFound, "no such item", id) }))
+	s.Bind(Func("apply", func(fn *Function, v int) (int, error) {
+		ret := fn.Call(v)
+		return ret.Int(), ret.Err()
+	}))
+	s.Bind(Func("wait", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	server, conn := Pipe()
+	served := make(chan bool)
+	go func() {
+		s.ServeTransport(server, httptest.NewRequest("GET", "/gots", nil))
+		close(served)
+	}()
+
+	c := NewClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Ready(ctx); err != nil {
+		t.Fatalf("ready: %v", err)
+	}
+	names := c.Names()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "apply,find,sum,wait" {
+		t.Errorf("names = %v", names)
+	}
+
+	if v := c.Call(ctx, "sum", 1, 2); v.Err() != nil || v.Int() != 3 {
+		t.Errorf("sum = %v %v", v.Int(), v.Err())
+	}
+	if v := c.Call(ctx, "find", 7); v.Err() == nil || v.Err().(*Error).Code != CodeNotFound {
+		t.Errorf("find error = %v", v.Err())
+	}
+	if v := c.Call(ctx, "nope"); v.Err() == nil || v.Err().(*Error).Code != CodeNotFound {
+		t.Errorf("unknown binding error = %v", v.Err())
+	}
+
+	// callbacks and contexts
+	square := NewCallback(func(args []json.RawMessage) (interface{}, error) {
+		var v int
+		json.Unmarshal(args[0], &v)
+		return v * v, nil
+	})
+	if v := c.Call(ctx, "apply", square, 7); v.Err() != nil || v.Int() != 49 {
+		t.Errorf("apply = %v %v", v.Int(), v.Err())
+	}
+	<-square.Closed()
+	waitCtx, waitCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer waitCancel()
+	if v := c.Call(ctx, "wait", waitCtx); v.Err() == nil || v.Err().(*Error).Code != CodeDeadlineExceeded {
+		t.Errorf("wait error = %v", v.Err())
+	}
+
+	// the server calls exposed functions and eval
+	sess := s.Sessions()[0]
+	c.Eval = func(expr string) (interface{}, error) { return "eval " + expr, nil }
+	if v := sess.Eval("1+1"); v.String() != "eval 1+1" {
+		t.Errorf("eval = %v %v", v.String(), v.Err())
+	}
+	c.Expose("hello", func(args []json.RawMessage) (interface{}, error) { return "hi " + string(args[0]), nil })
+	if v := sess.Call("hello", 1); v.String() != "hi 1" {
+		t.Errorf("hello = %v %v", v.String(), v.Err())
+	}
+	if v := sess.Call("missing"); v.Err() == nil {
+		t.Errorf("missing function is called")
+	}
+
+	c.Close()
+	<-c.Done()
+	if v := c.Call(ctx, "sum", 1, 2); v.Err() != ErrDisconnected {
+		t.Errorf("call after close = %v", v.Err())
+	}
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeTransport does not return after the client is closed")
+	}
+}
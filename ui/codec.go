@@ -0,0 +1,337 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes messages on the wire, it is negotiated per connection by Gots.hello.
+//
+// Messages are built as json, a codec transcodes them from and to its own format.
+// Messages of a codec other than JSONCodec are sent in binary frames.
+type Codec interface {
+	Name() string
+	Encode(msg json.RawMessage) ([]byte, error)
+	Decode(data []byte) (json.RawMessage, error)
+}
+
+var (
+	// JSONCodec is the default codec, which is supported by every client.
+	JSONCodec Codec = jsonCodec{}
+	// MsgPackCodec encodes messages as MessagePack, which is cheaper to decode for large numeric arrays.
+	MsgPackCodec Codec = msgpackCodec{}
+)
+
+// codecMark is the first byte of a binary frame with a message, which is never the first byte of a blob chunk.
+const codecMark = 0xff
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                                { return "json" }
+func (jsonCodec) Encode(msg json.RawMessage) ([]byte, error)  { return msg, nil }
+func (jsonCodec) Decode(data []byte) (json.RawMessage, error) { return data, nil }
+
+// pickCodec chooses the first server codec offered by the client, or JSONCodec.
+func pickCodec(server []Codec, client []string) Codec {
+	for _, c := range server {
+		for _, name := range client {
+			if c.Name() == name {
+				return c
+			}
+		}
+	}
+	return JSONCodec
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Encode(msg json.RawMessage) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(msg))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := packValue(buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(data []byte) (json.RawMessage, error) {
+	r := &unpacker{data: data}
+	v, err := r.value()
+	if err != nil {
+		return nil, err
+	}
+	if r.off != len(data) {
+		return nil, fmt.Errorf("msgpack: %d bytes after the message", len(data)-r.off)
+	}
+	return json.Marshal(v)
+}
+
+// packValue encodes a json value decoded with UseNumber.
+func packValue(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		packNumber(buf, v)
+	case string:
+		packLen(buf, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []interface{}:
+		packLen(buf, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, elem := range v {
+			if err := packValue(buf, elem); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		packLen(buf, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		for key, elem := range v {
+			packLen(buf, len(key), 0xa0, 31, 0xd9, 0xda, 0xdb)
+			buf.WriteString(key)
+			if err := packValue(buf, elem); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unexpected json value %T", v)
+	}
+	return nil
+}
+
+// packLen writes the header of a string, array or map, code8 is 0 when there is no 8 bits form.
+func packLen(buf *bytes.Buffer, n int, fix byte, fixMax int, code8, code16, code32 byte) {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		buf.Write([]byte{code8, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func packNumber(buf *bytes.Buffer, n json.Number) {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			packInt(buf, i)
+			return
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, u)
+			return
+		}
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, f)
+}
+
+func packInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f, i < 0 && i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.Write([]byte{0xd0, byte(i)})
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+// maxUnpackDepth limits nesting of decoded arrays and maps, like encoding/json.
+const maxUnpackDepth = 10000
+
+// unpacker decodes msgpack into json values, bin is a base64 string like []byte in json.
+type unpacker struct {
+	data  []byte
+	off   int
+	depth int
+}
+
+// enter counts a nested array or map, the caller calls leave when it is decoded.
+func (r *unpacker) enter() error {
+	r.depth++
+	if r.depth > maxUnpackDepth {
+		return fmt.Errorf("msgpack: exceeded max depth %d", maxUnpackDepth)
+	}
+	return nil
+}
+
+func (r *unpacker) leave() {
+	r.depth--
+}
+
+func (r *unpacker) next(n int) ([]byte, error) {
+	if n < 0 || r.off+n > len(r.data) {
+		return nil, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b, nil
+}
+
+func (r *unpacker) uint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (r *unpacker) value() (interface{}, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return r.mapValue(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return r.array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return r.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return r.next(int(n))
+	case 0xca:
+		u, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := r.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.uint(1 << (c - 0xcc))
+	case 0xd0:
+		u, err := r.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := r.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := r.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := r.uint(8)
+		return int64(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.array(int(n))
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.mapValue(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%x", c)
+}
+
+func (r *unpacker) str(n int) (interface{}, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (r *unpacker) array(n int) (interface{}, error) {
+	if n > len(r.data)-r.off {
+		return nil, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	if err := r.enter(); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	ret := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+func (r *unpacker) mapValue(n int) (interface{}, error) {
+	if n > (len(r.data)-r.off)/2 {
+		return nil, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	if err := r.enter(); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	ret := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		ret[fmt.Sprint(k)] = v
+	}
+	return ret, nil
+}
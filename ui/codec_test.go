@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMsgPackCodec(t *testing.T) {
+	in := `{"id":1,"method":"Gots.ret","params":{"result":[0,-1,-33,127,128,-129,70000,-70000,4294967296,1.5,"","ok",true,null],"error":null,"text":"` + strings.Repeat("x", 300) + `"}}`
+	in = string(mustJSON(t, in)) // normalize escapes
+	data, err := MsgPackCodec.Encode(json.RawMessage(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := MsgPackCodec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b interface{}
+	json.Unmarshal([]byte(in), &a)
+	json.Unmarshal(out, &b)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("round trip:\n%s\ngot:\n%s", in, out)
+	}
+
+	if _, err := MsgPackCodec.Decode([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Errorf("truncated array is decoded")
+	}
+}
+
+func TestPickCodec(t *testing.T) {
+	if c := pickCodec([]Codec{MsgPackCodec}, []string{"msgpack", "json"}); c != MsgPackCodec {
+		t.Errorf("codec = %s", c.Name())
+	}
+	if c := pickCodec([]Codec{MsgPackCodec}, nil); c != JSONCodec {
+		t.Errorf("codec of a legacy client = %s", c.Name())
+	}
+}
+
+func mustJSON(t *testing.T, text string) []byte {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(v)
+	return raw
+}
+
+func TestMsgPackDepth(t *testing.T) {
+	// [[[...nil]]] and {"0": {"0": ...nil}}
+	for _, level := range [][]byte{{0x91}, {0x81, 0x00}} {
+		nested := func(n int) []byte {
+			return append(bytes.Repeat(level, n), 0xc0)
+		}
+		if _, err := MsgPackCodec.Decode(nested(100)); err != nil {
+			t.Errorf("%x * 100: %v", level, err)
+		}
+		if _, err := MsgPackCodec.Decode(nested(20 << 20)); err == nil || !strings.Contains(err.Error(), "depth") {
+			t.Errorf("%x * 20M error = %v", level, err)
+		}
+	}
+}
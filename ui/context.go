@@ -6,8 +6,9 @@ import (
 )
 
 type Context struct {
-	Seq int `json:"seq"`
-	ctx context.Context
+	Seq     int      `json:"seq"`
+	Timeout *float64 `json:"timeout,omitempty"` // remaining milliseconds of a javascript deadline
+	ctx     context.Context
 }
 
 func (c *Context) Deadline() (deadline time.Time, ok bool) {
@@ -26,8 +27,20 @@ func (c *Context) Value(key interface{}) interface{} {
 	return c.ctx.Value(key)
 }
 
+// WithCancel makes the context cancelable, a deadline set by javascript is applied as well.
 func (c *Context) WithCancel() context.CancelFunc {
-	ctx, cancel := context.WithCancel(context.Background())
+	return c.withCancel(context.Background())
+}
+
+// withCancel derives the context from parent, which is usually the connection lifetime.
+func (c *Context) withCancel(parent context.Context) context.CancelFunc {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.Timeout != nil {
+		ctx, cancel = context.WithTimeout(parent, time.Duration(*c.Timeout*float64(time.Millisecond)))
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
 	c.ctx = ctx
 	return cancel
 }
@@ -0,0 +1,439 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ctxType       = reflect.TypeOf((*context.Context)(nil)).Elem()
+	fnType        = reflect.TypeOf((*Function)(nil))
+	errType       = reflect.TypeOf((*error)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textKeyType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// builtin declarations, these names are reserved for the generator
+const dtsHeader = `// Code generated by gots. DO NOT EDIT.
+
+export type CancelFunc = () => void;
+
+export type Callback = (...args: any[]) => any;
+
+export interface GotsError extends Error {
+  code: string;
+  details?: any;
+  goStack?: string;
+}
+
+export interface Gots {
+  Error: new (e: { code: string; message: string; details?: any }) => GotsError;
+  on(topic: string, handler: (payload: any) => void): () => void;
+  off(topic: string, handler?: (payload: any) => void): void;
+  expose(name: string, fn: (...args: any[]) => any): () => void;
+  unexpose(name: string): void;
+}
+
+export interface Context {
+  cancel(): void;
+}
+
+export interface ContextPackage {
+  withCancel(): [Context, CancelFunc];
+  withTimeout(ms: number): [Context, CancelFunc];
+  withDeadline(deadline: Date | number): [Context, CancelFunc];
+  background(): Context;
+  todo(): Context;
+}
+`
+
+var dtsReserved = []string{"API", "CancelFunc", "Callback", "Context", "ContextPackage", "Gots", "GotsError"}
+
+// WriteDTS writes TypeScript declarations of bindings to w.
+// The api object is declared as interface API, every binding returns a Promise
+// and dotted binding names are declared as nested objects.
+// Delayed bindings without a prototype are declared as (...args: any[]) => Promise<any>.
+func WriteDTS(w io.Writer, bindings []Bindings) error {
+	return writeDTS(w, bindings, nil)
+}
+
+// writeDTS skips bindings which are hidden.
+func writeDTS(w io.Writer, bindings []Bindings, hidden func(name string) bool) error {
+	root := &dtsNode{}
+	for _, b := range bindings {
+		if b.Error() != nil {
+			return b.Error()
+		}
+		protos := getPrototypes(b)
+		for _, name := range b.Names() {
+			if hidden != nil && hidden(name) {
+				continue
+			}
+			fn, ok := protos[name]
+			if !ok {
+				root.add(name, nil)
+				continue
+			}
+			if reflect.TypeOf(fn).Kind() != reflect.Func {
+				return fmt.Errorf("gen dts %s: should be a function", name)
+			}
+			root.add(name, reflect.TypeOf(fn))
+		}
+	}
+
+	g := newDTSGen()
+	api := &bytes.Buffer{}
+	fmt.Fprintf(api, "\nexport interface API {\n")
+	fmt.Fprintf(api, "  %s: Gots;\n", ReadyFuncName)
+	fmt.Fprintf(api, "  %s: ContextPackage;\n", ContextBindingName)
+	g.members(api, root, "  ")
+	fmt.Fprintf(api, "}\n")
+
+	types := &bytes.Buffer{}
+	for i := 0; i < len(g.order); i++ {
+		g.declare(types, g.order[i])
+	}
+
+	for _, buf := range []*bytes.Buffer{bytes.NewBufferString(dtsHeader), api, types} {
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dtsNode is a binding namespace.
+type dtsNode struct {
+	fn       reflect.Type // function type if it is a binding
+	bound    bool         // is a binding
+	children map[string]*dtsNode
+}
+
+func (n *dtsNode) add(name string, fn reflect.Type) {
+	node := n
+	for _, part := range strings.Split(name, ".") {
+		if node.children == nil {
+			node.children = map[string]*dtsNode{}
+		}
+		child, ok := node.children[part]
+		if !ok {
+			child = &dtsNode{}
+			node.children[part] = child
+		}
+		node = child
+	}
+	node.bound = true
+	node.fn = fn
+}
+
+type dtsGen struct {
+	names map[reflect.Type]string
+	taken map[string]bool
+	order []reflect.Type
+}
+
+func newDTSGen() *dtsGen {
+	g := &dtsGen{names: map[reflect.Type]string{}, taken: map[string]bool{}}
+	for _, name := range dtsReserved {
+		g.taken[name] = true
+	}
+	return g
+}
+
+func (g *dtsGen) members(w io.Writer, n *dtsNode, indent string) {
+	names := []string{}
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := n.children[name]
+		key := tsKey(name)
+		switch {
+		case child.bound && child.children == nil:
+			fmt.Fprintf(w, "%s%s%s;\n", indent, key, g.signature(child.fn, ": "))
+		case child.bound:
+			fmt.Fprintf(w, "%s%s: (%s) & {\n", indent, key, g.signature(child.fn, " => "))
+			g.members(w, child, indent+"  ")
+			fmt.Fprintf(w, "%s};\n", indent)
+		default:
+			fmt.Fprintf(w, "%s%s: {\n", indent, key)
+			g.members(w, child, indent+"  ")
+			fmt.Fprintf(w, "%s};\n", indent)
+		}
+	}
+}
+
+// signature renders "(params)<sep>Promise<result>".
+func (g *dtsGen) signature(fn reflect.Type, sep string) string {
+	if fn == nil {
+		return fmt.Sprintf("(...args: any[])%sPromise<any>", sep)
+	}
+	params := []string{}
+	jsIn := jsParams(fn)
+	optional := len(jsIn) // params from optional are optional
+	for optional > 0 && isOptional(fn.In(jsIn[optional-1])) {
+		optional--
+	}
+	for j, i := range jsIn {
+		mark := ""
+		if j >= optional {
+			mark = "?"
+		}
+		params = append(params, fmt.Sprintf("arg%d%s: %s", j, mark, g.param(fn.In(i))))
+	}
+	if fn.IsVariadic() {
+		elem := g.param(fn.In(fn.NumIn() - 1).Elem())
+		if strings.ContainsAny(elem, " |&") {
+			elem = fmt.Sprintf("(%s)", elem)
+		}
+		params = append(params, fmt.Sprintf("...arg%d: %s[]", len(jsIn), elem))
+	}
+	return fmt.Sprintf("(%s)%sPromise<%s>", strings.Join(params, ", "), sep, g.result(fn))
+}
+
+func (g *dtsGen) param(t reflect.Type) string {
+	switch t {
+	case ctxType:
+		return "Context | AbortSignal"
+	case fnType:
+		return "Callback"
+	case bytesType:
+		return "Uint8Array | ArrayBuffer | Blob"
+	case readerType:
+		return "Uint8Array | ArrayBuffer | Blob | string"
+	}
+	return g.tsType(t)
+}
+
+func (g *dtsGen) result(fn reflect.Type) string {
+	n := fn.NumOut()
+	if n > 0 && fn.Out(n-1) == errType {
+		n--
+	}
+	if n == 0 {
+		return "void"
+	}
+	if t := fn.Out(0); isStream(t) {
+		return fmt.Sprintf("AsyncIterable<%s>", g.tsType(t.Elem()))
+	}
+	switch t := fn.Out(0); {
+	case t == bytesType:
+		return "Uint8Array"
+	case t.Implements(readerType):
+		return "Blob"
+	}
+	return g.tsType(fn.Out(0))
+}
+
+// tsType maps a go type to the typescript type of its json encoding.
+func (g *dtsGen) tsType(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t == rawType:
+		return "any"
+	case t.Implements(marshalerType), reflect.PtrTo(t).Implements(marshalerType):
+		return "any"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Ptr:
+		elem := g.tsType(t.Elem())
+		if elem == "any" || strings.HasSuffix(elem, " | null") {
+			return elem
+		}
+		return elem + " | null" // nil is null
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return "string" // base64
+		}
+		elem := g.tsType(t.Elem())
+		if strings.ContainsAny(elem, " |&") {
+			return fmt.Sprintf("Array<%s>", elem)
+		}
+		return elem + "[]"
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !t.Key().Implements(textKeyType) {
+				return "any"
+			}
+		}
+		return fmt.Sprintf("{ [key: string]: %s }", g.tsType(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.literal(t)
+		}
+		return g.named(t)
+	}
+	return "any"
+}
+
+// named returns the interface name of a struct, and queue it for declaration.
+func (g *dtsGen) named(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := tsIdent(t.Name())
+	if g.taken[name] {
+		pkg := tsIdent(path.Base(t.PkgPath()))
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	for i, base := 2, name; g.taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.taken[name] = true
+	g.names[t] = name
+	g.order = append(g.order, t)
+	return name
+}
+
+func (g *dtsGen) declare(w io.Writer, t reflect.Type) {
+	fmt.Fprintf(w, "\nexport interface %s {\n", g.names[t])
+	for _, f := range jsonFields(t) {
+		fmt.Fprintf(w, "  %s;\n", g.field(f))
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+func (g *dtsGen) literal(t reflect.Type) string {
+	fields := []string{}
+	for _, f := range jsonFields(t) {
+		fields = append(fields, g.field(f))
+	}
+	if len(fields) == 0 {
+		return "{}"
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(fields, "; "))
+}
+
+func (g *dtsGen) field(f jsonField) string {
+	typ := g.tsType(f.typ)
+	if f.quoted {
+		typ = "string"
+	}
+	optional := ""
+	if f.omitEmpty {
+		optional = "?"
+	}
+	return fmt.Sprintf("%s%s: %s", tsKey(f.name), optional, typ)
+}
+
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	omitEmpty bool
+	quoted    bool
+	depth     int
+}
+
+// jsonFields lists fields of a struct in the way encoding/json does,
+// embedded structs are flattened and shallower fields win.
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+	index := map[string]int{}
+	var walk func(t reflect.Type, depth int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, depth int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if i := strings.Index(tag, ","); i != -1 {
+				name, opts = tag[:i], tag[i:]
+			}
+
+			ft := sf.Type
+			if sf.Anonymous {
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+					continue // unexported
+				}
+				if name == "" && ft.Kind() == reflect.Struct {
+					walk(ft, depth+1, visited)
+					continue
+				}
+			} else if sf.PkgPath != "" {
+				continue // unexported
+			}
+
+			if name == "" {
+				name = sf.Name
+			}
+			f := jsonField{
+				name:      name,
+				typ:       sf.Type,
+				omitEmpty: strings.Contains(opts, ",omitempty"),
+				quoted:    strings.Contains(opts, ",string"),
+				depth:     depth,
+			}
+			if i, ok := index[name]; ok {
+				if fields[i].depth > depth {
+					fields[i] = f
+				}
+				continue
+			}
+			index[name] = len(fields)
+			fields = append(fields, f)
+		}
+	}
+	walk(t, 0, map[reflect.Type]bool{})
+	return fields
+}
+
+func tsIdent(name string) string {
+	ret := []rune{}
+	for i, r := range name {
+		if r == '_' || r == '$' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			ret = append(ret, r)
+		} else {
+			ret = append(ret, '_')
+		}
+	}
+	if len(ret) == 0 {
+		return "_"
+	}
+	return string(ret)
+}
+
+func tsKey(name string) string {
+	if name != "" && tsIdent(name) == name {
+		return name
+	}
+	raw, _ := json.Marshal(name)
+	return string(raw)
+}
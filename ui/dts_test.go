@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type dtsItem struct {
+	Name    string   `json:"name"`
+	Size    int      `json:"size,omitempty"`
+	Tags    []string `json:"tags"`
+	Next    *dtsItem `json:"next"`
+	Hidden  string   `json:"-"`
+	private int
+	dtsBase
+}
+
+type dtsBase struct {
+	ID string `json:"id"`
+}
+
+type dtsAPI struct{}
+
+func (*dtsAPI) Find(ctx context.Context, name string) (*dtsItem, error) { return nil, nil }
+
+func (*dtsAPI) Watch(fn *Function) error { return nil }
+
+func (*dtsAPI) Whoami(r *http.Request, s *Session, prefix string) string { return "" }
+
+func (*dtsAPI) Thumbnail(image []byte) (io.Reader, error) { return nil, nil }
+
+func TestWriteDTS(t *testing.T) {
+	binds := []Bindings{
+		Func("sum", sum),
+		Func("sprintf", fmt.Sprintf),
+		Prefix("store", Object(&dtsAPI{})),
+		DelayObject(someValue{}, func(*UIContext) Bindings { return Object(someValue{}) }),
+		Delay([]string{"later"}, func(*UIContext) Bindings { return Func("later", sum) }),
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteDTS(buf, binds); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"  sum(arg0: number, arg1: number): Promise<number>;\n",
+		"  store: {\n    find(arg0: Context | AbortSignal, arg1: string): Promise<dtsItem | null>;\n    thumbnail(arg0: Uint8Array | ArrayBuffer | Blob): Promise<Blob>;\n    watch(arg0?: Callback): Promise<void>;\n    whoami(arg0: string): Promise<string>;\n  };\n",
+		"  value(arg0: number, arg1: number): Promise<number>;\n",
+		"  later(...args: any[]): Promise<any>;\n",
+		"  sprintf(arg0: string, ...arg1: any[]): Promise<string>;\n",
+		"export interface dtsItem {\n  name: string;\n  size?: number;\n  tags: string[];\n  next: dtsItem | null;\n  id: string;\n}\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing declaration:\n%s\ngot:\n%s", want, out)
+		}
+	}
+}
+
+func TestServeDTS(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	s.Prefix = "/app"
+	if err := s.Bind(Prefix("math", Func("sum", sum))); err != nil {
+		t.Fatal(err)
+	}
+	s.installHandlers(nil, false)
+
+	w := httptest.NewRecorder()
+	s.serveMux.ServeHTTP(w, httptest.NewRequest("GET", "/app/gots.d.ts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if want := "  math: {\n    sum(arg0: number, arg1: number): Promise<number>;\n  };\n"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("missing declaration:\n%s\ngot:\n%s", want, w.Body.String())
+	}
+}
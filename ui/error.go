@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Error codes known by gots, any other code may be used as well.
+const (
+	CodeUnknown            = "unknown"
+	CodeInvalidArgument    = "invalid_argument"
+	CodeNotFound           = "not_found"
+	CodePermissionDenied   = "permission_denied"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeCanceled           = "canceled"
+	CodeDeadlineExceeded   = "deadline_exceeded"
+	CodeUnavailable        = "unavailable"
+	CodeFailedPrecondition = "failed_precondition"
+	CodeInternal           = "internal"
+)
+
+// CodedError is an error which tells javascript its code and details.
+type CodedError interface {
+	error
+	ErrorCode() string
+	ErrorData() interface{}
+}
+
+// Error is the error envelope sent to javascript, where it is rejected as a Gots.Error.
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	Stack   string      `json:"stack,omitempty"` // dev mode only
+}
+
+// NewError creates a CodedError, details should be a json value.
+func NewError(code string, message string, details interface{}) *Error {
+	e := &Error{Code: code, Message: message, Details: details}
+	if dev {
+		e.Stack = string(debug.Stack())
+	}
+	return e
+}
+
+// Errorf creates a CodedError without details.
+func Errorf(code string, format string, a ...interface{}) *Error {
+	return NewError(code, fmt.Sprintf(format, a...), nil)
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) ErrorCode() string { return e.Code }
+
+func (e *Error) ErrorData() interface{} { return e.Details }
+
+// toError converts any error to an envelope.
+func toError(err error) *Error {
+	ret := &Error{Code: CodeUnknown, Message: err.Error()}
+	var coded CodedError
+	switch {
+	case errors.As(err, &coded):
+		ret.Code = coded.ErrorCode()
+		ret.Details = coded.ErrorData()
+	case errors.Is(err, context.Canceled):
+		ret.Code = CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		ret.Code = CodeDeadlineExceeded
+	}
+	if _, err := json.Marshal(ret.Details); err != nil {
+		ret.Details = nil
+	}
+
+	if dev {
+		var e *Error
+		if errors.As(err, &e) && e.Stack != "" {
+			ret.Stack = e.Stack
+		} else if s := fmt.Sprintf("%+v", err); s != ret.Message {
+			ret.Stack = s // errors with stack trace
+		}
+	}
+	return ret
+}
@@ -0,0 +1,28 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestToError(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+		msg  string
+	}{
+		{errors.New("boom"), CodeUnknown, "boom"},
+		{NewError(CodeNotFound, "missing", h{"id": 1}), CodeNotFound, "missing"},
+		{fmt.Errorf("load: %w", Errorf(CodePermissionDenied, "denied")), CodePermissionDenied, "load: denied"},
+		{fmt.Errorf("wait: %w", context.DeadlineExceeded), CodeDeadlineExceeded, "wait: context deadline exceeded"},
+		{NewError(CodeInternal, "bad details", func() {}), CodeInternal, "bad details"},
+	}
+	for _, c := range cases {
+		e := toError(c.err)
+		if e.Code != c.code || e.Message != c.msg {
+			t.Errorf("toError(%v) = %s %q, want %s %q", c.err, e.Code, e.Message, c.code, c.msg)
+		}
+	}
+}
@@ -1,39 +1,135 @@
 package ui
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 )
 
+// ErrReleased is returned when calling a released callback.
+var ErrReleased = errors.New("callback is released")
+
 // Function wraps a js callback function.
+//
+// A callback is released when the bound function returns.
+// Retain it to call it later from other goroutines, and Release it when done.
+// All callbacks are released when the client is disconnected.
 type Function struct {
 	BindingName string `json:"bindingName"`
 	Seq         int    `json:"seq"`
 
-	jsc *jsClient
+	jsc      *jsClient
+	mu       sync.Mutex
+	refs     int // the bound function call holds the first reference
+	released bool
 }
 
-// close is called by page automatically
-func (c *Function) close() {
+// attach is called by page when the callback is received.
+func (c *Function) attach(jsc *jsClient) {
+	c.jsc = jsc
+	c.refs = 1
+}
+
+// Retain keeps the callback alive after the bound function returns.
+// Every Retain should be paired with a Release.
+func (c *Function) Retain() error {
+	if c == nil || c.jsc == nil {
+		return fmt.Errorf("invalid callback")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.released {
+		return ErrReleased
+	}
+	select {
+	case <-c.jsc.done:
+		return ErrDisconnected
+	default:
+	}
+	c.refs++
+	return nil
+}
+
+// Release drops a reference, the javascript function is freed when the last reference is released.
+func (c *Function) Release() {
 	if c == nil {
 		return
 	}
+	c.mu.Lock()
+	if c.released {
+		c.mu.Unlock()
+		return
+	}
+	c.refs--
+	if c.refs > 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.released = true
+	c.mu.Unlock()
+	c.close()
+}
+
+// Done is closed when the client is disconnected, it is closed already for an invalid callback.
+func (c *Function) Done() <-chan struct{} {
+	if c == nil || c.jsc == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return c.jsc.done
+}
+
+// close frees the javascript function.
+func (c *Function) close() {
+	if c.jsc == nil {
+		return
+	}
+	select {
+	case <-c.jsc.done:
+		return // released with the connection
+	default:
+	}
 	_, err := c.jsc.send("Gots.closeCallback", h{"name": c.BindingName, "seq": c.Seq}, false)
 	if err != nil {
 		log.Println("close callback failed:", err)
 	}
 }
 
+func (c *Function) isReleased() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.released
+}
+
 // Call method.
 func (c *Function) Call(args ...interface{}) Value {
-	if c == nil {
+	return c.CallContext(context.Background(), args...)
+}
+
+// CallContext stops waiting for the callback when ctx is done.
+func (c *Function) CallContext(ctx context.Context, args ...interface{}) Value {
+	if c == nil || c.jsc == nil {
 		return value{err: fmt.Errorf("invalid callback")}
 	}
+	if c.isReleased() {
+		return value{err: ErrReleased}
+	}
+	select {
+	case <-c.jsc.done:
+		return value{err: ErrDisconnected}
+	default:
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
 	_, err := json.Marshal(args)
 	if err != nil {
 		return value{err: err}
 	}
-	v, err := c.jsc.send("Gots.callback", h{"name": c.BindingName, "seq": c.Seq, "args": args}, true)
+	v, err := c.jsc.sendContext(ctx, "Gots.callback", h{"name": c.BindingName, "seq": c.Seq, "args": args}, true)
 	return value{err: err, raw: v}
 }
@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFunctionRetain(t *testing.T) {
+	kept := make(chan *Function, 1)
+	_, c := newPipePage(t, map[string]BindingFunc{
+		"keep": func(fn *Function) error {
+			kept <- fn
+			return fn.Retain()
+		},
+		"sum": func(a, b int) int { return a + b },
+	})
+
+	// a retained callback is not closed when the call returns
+	cb := NewCallback(func(args []json.RawMessage) (interface{}, error) { return 42, nil })
+	if v := c.call("keep", cb); v.Err() != nil {
+		t.Fatalf("keep error = %v", v.Err())
+	}
+	fn := <-kept
+	if v := fn.Call(); v.Err() != nil || v.Int() != 42 {
+		t.Fatalf("call after return = %v %v", v.Int(), v.Err())
+	}
+	select {
+	case <-cb.Closed():
+		t.Fatal("retained callback is closed")
+	default:
+	}
+
+	// the last release closes the callback once
+	fn.Release()
+	select {
+	case <-cb.Closed():
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback is not closed after release")
+	}
+	fn.Release()
+	if v := fn.Call(); v.Err() != ErrReleased {
+		t.Errorf("call after release = %v", v.Err())
+	}
+	if err := fn.Retain(); err != ErrReleased {
+		t.Errorf("retain after release = %v", err)
+	}
+	if v := c.call("sum", 1, 2); v.Int() != 3 {
+		t.Errorf("sum = %v %v", v.Int(), v.Err())
+	}
+	select {
+	case m := <-c.unhandled:
+		t.Errorf("unexpected %s %s", m.Method, m.Params)
+	default:
+	}
+}
+
+func TestFunctionDisconnect(t *testing.T) {
+	kept := make(chan *Function, 1)
+	p, c := newPipePage(t, map[string]BindingFunc{
+		"keep": func(fn *Function) error {
+			kept <- fn
+			return fn.Retain()
+		},
+	})
+
+	c.call("keep", NewCallback(func(args []json.RawMessage) (interface{}, error) { return nil, nil }))
+	fn := <-kept
+	c.Close()
+	<-p.Done()
+	select {
+	case <-fn.Done():
+	case <-time.After(time.Second):
+		t.Fatal("callback is not done after the client is closed")
+	}
+	if v := fn.Call(); v.Err() != ErrDisconnected {
+		t.Errorf("call after disconnect = %v", v.Err())
+	}
+	if err := fn.Retain(); err != ErrDisconnected {
+		t.Errorf("retain after disconnect = %v", err)
+	}
+	fn.Release()
+
+	// an invalid callback is done
+	var nilFn *Function
+	for _, fn := range []*Function{nilFn, {}} {
+		select {
+		case <-fn.Done():
+		default:
+			t.Errorf("invalid callback is not done")
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package ui
+
+// BindingCall is a binding call seen by interceptors.
+type BindingCall struct {
+	Name    string        // binding name
+	Args    []interface{} // decoded arguments, may be changed before calling next
+	Context *UIContext    // session of the caller
+}
+
+// Invoker calls the next interceptor or the bound function.
+type Invoker func(call *BindingCall) (interface{}, error)
+
+// Interceptor wraps every binding call.
+// It can short-circuit the call by not calling next, and it sees the result or error of next.
+type Interceptor func(call *BindingCall, next Invoker) (interface{}, error)
+
+// chainInterceptors makes an invoker where the first interceptor is the outermost one.
+func chainInterceptors(interceptors []Interceptor, invoke Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(call *BindingCall) (interface{}, error) {
+			return interceptor(call, next)
+		}
+	}
+	return invoke
+}
@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChainInterceptors(t *testing.T) {
+	trace := []string{}
+	tracer := func(name string) Interceptor {
+		return func(call *BindingCall, next Invoker) (interface{}, error) {
+			trace = append(trace, name)
+			if call.Name == name {
+				return "short", nil
+			}
+			return next(call)
+		}
+	}
+	invoke := chainInterceptors([]Interceptor{tracer("a"), tracer("b")}, func(call *BindingCall) (interface{}, error) {
+		trace = append(trace, "call")
+		return "done", nil
+	})
+
+	if ret, _ := invoke(&BindingCall{Name: "sum"}); ret != "done" {
+		t.Errorf("ret = %v", ret)
+	}
+	if want := []string{"a", "b", "call"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %v, want %v", trace, want)
+	}
+
+	trace = nil
+	if ret, _ := invoke(&BindingCall{Name: "a"}); ret != "short" {
+		t.Errorf("ret = %v", ret)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %v, want %v", trace, want)
+	}
+}
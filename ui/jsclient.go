@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"runtime/debug"
+	"sort"
 	"sync"
 	"sync/atomic"
-
-	"golang.org/x/net/websocket"
+	"time"
 )
 
+// ErrDisconnected is returned to callers waiting for a reply from a lost client.
+var ErrDisconnected = errors.New("javascript client disconnected")
+
 type result struct {
 	Value json.RawMessage
 	Err   error
@@ -42,58 +47,150 @@ type refCallParams struct {
 	Seq int `json:"seq"`
 }
 
+type exposeParams struct {
+	Names []string `json:"names"`
+}
+
 type h map[string]interface{}
 
+// connConfig is per-connection settings from the server.
+type connConfig struct {
+	onPanic           func(binding string, v interface{}, stack []byte)
+	interceptors      []Interceptor
+	heartbeatInterval time.Duration // 0 disables heartbeat
+	heartbeatTimeout  time.Duration
+	codecs            []Codec // offered to clients in preference order
+}
+
 type jsClient struct {
+	latency int64 // round trip time of the last heartbeat in nanoseconds, first for 64-bit alignment
 	sync.Mutex
 	id      int32
 	pending map[int]chan result
-	ws      *websocket.Conn
+	conn    Transport
 	binding map[string]bindingFunc
-	refs    map[int]func() // int -> func()
-	done    chan struct{}  // done = readLoop() return = receive EOF
+	exposed map[string]bool           // functions exposed by Gots.expose
+	refs    map[int]func()            // int -> func()
+	streams map[callKey]chan struct{} // running stream results, closed to stop them
+	done    chan struct{}             // done = readLoop() return = receive EOF
+	ctx     context.Context           // canceled when the connection is lost
 	cancel  context.CancelFunc
+	conf    connConfig
+
+	hello    chan helloParams // the first Gots.hello
+	version  int              // negotiated protocol version
+	features map[string]bool  // negotiated features
+	codec    Codec            // negotiated codec of sent messages
+
+	blobID    int32          // last sent blob
+	blobs     map[int][]byte // received blobs, guarded by mutex
+	blobBytes int            // size of blobs
+	received  map[int]bool   // blobs with the final chunk
 }
 
-func newJSClient(ws *websocket.Conn) (*jsClient, error) {
+func newJSClient(conn Transport, conf *connConfig) (*jsClient, error) {
+	if conf == nil {
+		conf = &connConfig{}
+	}
 	p := &jsClient{
-		ws:      ws,
+		conn:    conn,
+		conf:    *conf,
 		pending: map[int]chan result{},
 		binding: map[string]bindingFunc{},
+		exposed: map[string]bool{},
 		refs:    map[int]func(){},
+		streams: map[callKey]chan struct{}{},
 		done:    make(chan struct{}),
+		hello:   make(chan helloParams, 1),
+		codec:   JSONCodec,
+
+		blobs:    map[int][]byte{},
+		received: map[int]bool{},
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	p.ctx = ctx
 	p.cancel = cancel
 	go p.readLoop(ctx)
 	return p, nil
 }
 
+// startHeartbeat is called when the client supports heartbeat.
+func (p *jsClient) startHeartbeat() {
+	if p.conf.heartbeatInterval > 0 {
+		go p.heartbeat(p.conf.heartbeatInterval, p.conf.heartbeatTimeout)
+	}
+}
+
+// heartbeat pings the client every interval, and closes the connection when a pong is not received within timeout.
+func (p *jsClient) heartbeat(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+
+		start := time.Now()
+		dead := time.AfterFunc(timeout, func() {
+			log.Printf("heartbeat timeout after %v, close connection", timeout)
+			p.cancel()
+		})
+		_, err := p.send("Gots.ping", nil, true)
+		dead.Stop()
+		if err != nil {
+			return
+		}
+		atomic.StoreInt64(&p.latency, int64(time.Since(start)))
+	}
+}
+
+func (p *jsClient) getLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.latency))
+}
+
 func (p *jsClient) readLoop(ctx context.Context) {
 	defer close(p.done)
+	defer p.cancel() // cancel pending calls
 
 	// connection closer
 	go func() {
 		<-ctx.Done()
-		p.ws.Close()
+		p.conn.Close()
 	}()
 
 	for {
-		m := msg{}
-		if err := websocket.JSON.Receive(p.ws, &m); err != nil {
-			if errors.Is(err, io.EOF) {
-				log.Println("remote closed")
-				return
-			}
+		binary, data, err := p.conn.ReadMessage()
+		if err != nil {
 			if ctx.Err() != nil {
 				// cancel
 				return
 			}
+			if errors.Is(err, io.EOF) {
+				log.Println("remote closed")
+				return
+			}
 			log.Println("receive bad message:", err)
-			p.ws.Close()
+			p.conn.Close()
 			break
 			// continue
 		}
+		f := frame{binary: binary, data: data}
+		if f.binary && (len(f.data) == 0 || f.data[0] != codecMark) {
+			if err := p.putChunk(f.data); err != nil {
+				log.Println("receive bad blob:", err)
+				p.conn.Close()
+				break
+			}
+			continue
+		}
+		m, err := p.decode(f)
+		if err != nil {
+			log.Println("receive bad message:", err)
+			p.conn.Close()
+			break
+		}
 		if dev {
 			log.Printf("[receive] %s, param: %v", m.Method, string(m.Params))
 		}
@@ -138,25 +235,66 @@ func (p *jsClient) readLoop(ctx context.Context) {
 			p.Unlock()
 
 			if !ok {
+				p.dropBlobs(call.Args)
+				go func() {
+					jsErr := toError(Errorf(CodeNotFound, "binding not found: %s", call.Name))
+					_, err := p.send("Gots.ret", h{"name": call.Name, "seq": call.Seq, "result": nil, "error": jsErr}, false)
+					if err != nil && p.ctx.Err() == nil {
+						log.Println("binding call phrase 3 failed:", err)
+					}
+				}()
 				break
 			}
 
 			go func() {
-				// jsRet is null or string, jsErr is json value
+				// jsRet is json value, jsErr is null or error envelope
 				var jsRet, jsErr interface{}
 				// binding call phrase 2
-				if ret, err := binding(call.Args); err != nil {
-					jsErr = err.Error()
+				ret, err := p.invoke(call.Name, binding, call.Args)
+				p.dropBlobs(call.Args)
+				if s, ok := ret.(*stream); ok && err == nil {
+					if p.supports(FeatureStream) {
+						p.streamResult(call.Name, call.Seq, s)
+						return
+					}
+					s.close()
+					ret, err = nil, Errorf(CodeFailedPrecondition, "client does not support stream results, reload the page")
+				}
+				if err == nil {
+					ret, err = p.wireResult(ret)
+				}
+				if err != nil {
+					jsErr = toError(err)
 				} else if _, err = json.Marshal(ret); err != nil {
-					jsErr = err.Error()
+					jsErr = toError(Errorf(CodeInternal, "marshal result: %v", err))
 				} else {
 					jsRet = ret
 				}
 				_, err = p.send("Gots.ret", h{"name": call.Name, "seq": call.Seq, "result": jsRet, "error": jsErr}, false)
-				if err != nil {
+				if err != nil && p.ctx.Err() == nil { // ignore replies after disconnect
 					log.Println("binding call phrase 3 failed:", err)
 				}
 			}()
+		case "Gots.cancel":
+			cancel := callParams{}
+			err := json.Unmarshal([]byte(m.Params), &cancel)
+			if err != nil {
+				log.Println("Gots.cancel bad message:", err)
+				break
+			}
+			p.cancelStream(callKey{name: cancel.Name, seq: cancel.Seq})
+		case "Gots.hello":
+			hello := helloParams{}
+			err := json.Unmarshal([]byte(m.Params), &hello)
+			if err != nil {
+				log.Println("Gots.hello bad message:", err)
+				break
+			}
+			select {
+			case p.hello <- hello:
+			default:
+				log.Println("ignore repeated Gots.hello")
+			}
 		case "Gots.refCall":
 			refCall := refCallParams{}
 			err := json.Unmarshal([]byte(m.Params), &refCall)
@@ -164,12 +302,30 @@ func (p *jsClient) readLoop(ctx context.Context) {
 				log.Println("Gots.refCall bad message:", err)
 				break
 			}
+			p.Lock()
 			fn, ok := p.refs[refCall.Seq]
+			p.Unlock()
 			if !ok {
 				// log.Println("Gots.refCall ignore late cancel")
 				break
 			}
 			fn()
+		case "Gots.expose", "Gots.unexpose":
+			expose := exposeParams{}
+			err := json.Unmarshal([]byte(m.Params), &expose)
+			if err != nil {
+				log.Printf("%s bad message: %v", m.Method, err)
+				break
+			}
+			p.Lock()
+			for _, name := range expose.Names {
+				if m.Method == "Gots.expose" {
+					p.exposed[name] = true
+				} else {
+					delete(p.exposed, name)
+				}
+			}
+			p.Unlock()
 
 		default:
 			log.Println("unknown method:", m.Method)
@@ -177,7 +333,43 @@ func (p *jsClient) readLoop(ctx context.Context) {
 	}
 }
 
+// invoke calls a binding and recovers its panic as an internal error.
+func (p *jsClient) invoke(name string, binding bindingFunc, args []json.RawMessage) (ret interface{}, err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		stack := debug.Stack()
+		log.Printf("panic in binding %s: %v\n%s", name, v, stack)
+		if p.conf.onPanic != nil {
+			p.reportPanic(name, v, stack)
+		}
+		e := &Error{Code: CodeInternal, Message: fmt.Sprintf("panic in binding %s: %v", name, v)}
+		if dev {
+			e.Stack = string(stack)
+		}
+		ret, err = nil, e
+	}()
+	return binding(args)
+}
+
+// reportPanic calls the OnPanic hook, a panic of the hook itself is only logged.
+func (p *jsClient) reportPanic(name string, v interface{}, stack []byte) {
+	defer func() {
+		if hv := recover(); hv != nil {
+			log.Printf("panic in OnPanic of binding %s: %v", name, hv)
+		}
+	}()
+	p.conf.onPanic(name, v, stack)
+}
+
 func (p *jsClient) send(method string, params h, wait bool) (json.RawMessage, error) {
+	return p.sendContext(context.Background(), method, params, wait)
+}
+
+// sendContext stops waiting for the reply when ctx is done.
+func (p *jsClient) sendContext(ctx context.Context, method string, params h, wait bool) (json.RawMessage, error) {
 	if dev {
 		log.Printf("   [send] method %s, wait=%v", method, wait)
 	}
@@ -186,27 +378,106 @@ func (p *jsClient) send(method string, params h, wait bool) (json.RawMessage, er
 
 	var retCh chan result
 	if wait {
-		retCh = make(chan result)
+		retCh = make(chan result, 1) // never block readLoop when the waiter is gone
 		p.Lock()
 		p.pending[int(id)] = retCh
 		p.Unlock()
 	}
 
-	err := websocket.JSON.Send(p.ws, m)
+	err := p.write(m)
 	if err != nil {
-		// TODO: remove item in p.pending
+		if wait {
+			p.unpend(int(id))
+		}
 		return nil, err
 	}
 
 	if !wait {
 		return nil, nil
 	}
-	ret := <-retCh
-	return ret.Value, ret.Err
+	select {
+	case ret := <-retCh:
+		return ret.Value, ret.Err
+	case <-ctx.Done():
+		p.unpend(int(id))
+		return nil, ctx.Err()
+	case <-p.done:
+		p.unpend(int(id))
+		return nil, ErrDisconnected
+	}
 }
 
-func (p *jsClient) eval(expr string) (json.RawMessage, error) {
-	return p.send("Gots.call", h{"name": "eval", "args": []string{expr}}, true)
+// decode reads a json message, or a message of the negotiated codec in a binary frame.
+func (p *jsClient) decode(f frame) (msg, error) {
+	m := msg{}
+	data := f.data
+	if f.binary {
+		var err error
+		if data, err = p.getCodec().Decode(data[1:]); err != nil {
+			return m, err
+		}
+	}
+	err := json.Unmarshal(data, &m)
+	return m, err
+}
+
+// write encodes a message with the negotiated codec.
+// Gots.hello is always json, the client switches to the codec it names.
+func (p *jsClient) write(m h) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	codec := p.getCodec()
+	if codec == JSONCodec || m["method"] == "Gots.hello" {
+		return p.conn.WriteMessage(false, data)
+	}
+	data, err = codec.Encode(data)
+	if err != nil {
+		return err
+	}
+	return p.conn.WriteMessage(true, append([]byte{codecMark}, data...))
+}
+
+func (p *jsClient) getCodec() Codec {
+	p.Lock()
+	defer p.Unlock()
+	return p.codec
+}
+
+func (p *jsClient) unpend(id int) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.pending, id)
+}
+
+// eval awaits a thenable result in javascript.
+func (p *jsClient) eval(ctx context.Context, expr string) (json.RawMessage, error) {
+	return p.sendContext(ctx, "Gots.call", h{"name": "eval", "args": []string{expr}}, true)
+}
+
+// call invokes an exposed function or a global function by its dotted path.
+func (p *jsClient) call(ctx context.Context, path string, args []interface{}) (json.RawMessage, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return p.sendContext(ctx, "Gots.call", h{"name": "call", "path": path, "args": args}, true)
+}
+
+func (p *jsClient) exposedNames() []string {
+	p.Lock()
+	defer p.Unlock()
+	names := []string{}
+	for name := range p.exposed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *jsClient) emit(topic string, payload interface{}) error {
+	_, err := p.send("Gots.emit", h{"topic": topic, "payload": payload}, false)
+	return err
 }
 
 func (p *jsClient) bind(items map[string]bindingFunc) error {
@@ -231,17 +502,21 @@ func (p *jsClient) bind(items map[string]bindingFunc) error {
 	return nil
 }
 
-func (p *jsClient) ready() error {
-	if _, err := p.send("Gots.ready", nil, false); err != nil {
+func (p *jsClient) ready(params h) error {
+	if _, err := p.send("Gots.ready", params, false); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (p *jsClient) ref(seq int, fn func()) {
+	p.Lock()
+	defer p.Unlock()
 	p.refs[seq] = fn
 }
 
 func (p *jsClient) unref(seq int) {
+	p.Lock()
+	defer p.Unlock()
 	delete(p.refs, seq)
 }
@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatTimeout(t *testing.T) {
+	// a client which never answers pings
+	server, client := Pipe()
+	defer client.Close()
+	p, err := newPage(server, &connConfig{heartbeatInterval: 20 * time.Millisecond, heartbeatTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.jsc.startHeartbeat()
+
+	select {
+	case <-p.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("dead client is not detected")
+	}
+}
+
+func pendingCount(p *page) int {
+	p.jsc.Lock()
+	defer p.jsc.Unlock()
+	return len(p.jsc.pending)
+}
+
+func TestSendContext(t *testing.T) {
+	p, c := newPipePage(t, nil)
+
+	// a timeout stops waiting and forgets the request
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if v := p.EvalContext(ctx, "new Promise(() => {})"); v.Err() != context.DeadlineExceeded {
+		t.Errorf("timeout error = %v", v.Err())
+	}
+	if n := pendingCount(p); n != 0 {
+		t.Errorf("%d pending after timeout", n)
+	}
+	// a late reply is dropped
+	late := c.recv("Gots.call")
+	c.write(h{"id": late.ID, "method": "Gots.ret", "params": h{"result": 1}})
+
+	// every waiter gets ErrDisconnected
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { errs <- p.EvalContext(context.Background(), "wait()").Err() }()
+	}
+	for i := 0; i < 3; i++ {
+		c.recv("Gots.call")
+	}
+	if n := pendingCount(p); n != 3 {
+		t.Errorf("%d pending, want 3", n)
+	}
+	c.Close()
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if err != ErrDisconnected {
+				t.Errorf("disconnect error = %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("waiter is not released by a disconnect")
+		}
+	}
+	if n := pendingCount(p); n != 0 {
+		t.Errorf("%d pending after disconnect", n)
+	}
+}
+
+// brokenWrites fails every write, reads still work.
+type brokenWrites struct {
+	Transport
+}
+
+func (brokenWrites) WriteMessage(binary bool, data []byte) error {
+	return errors.New("broken")
+}
+
+func TestSendContextWriteError(t *testing.T) {
+	server, client := Pipe()
+	defer client.Close()
+	p, err := newPage(brokenWrites{server}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if v := p.EvalContext(context.Background(), "1"); v.Err() == nil || v.Err().Error() != "broken" {
+		t.Errorf("write error = %v", v.Err())
+	}
+	if n := pendingCount(p); n != 0 {
+		t.Errorf("%d pending after a failed write", n)
+	}
+}
@@ -38,6 +38,18 @@ type uiConfig struct {
 	OnlineAttachTLS bool
 	LocalMapURL     func(net.Listener) string
 	LocalExitDelay  *time.Duration
+	OnPanic         func(binding string, v interface{}, stack []byte)
+	Interceptors    []Interceptor
+	OnConnect       func(*Session)
+	OnDisconnect    func(*Session)
+	SessionCookie   string
+	SessionTTL      time.Duration
+	ResumeWindow    time.Duration
+	ReconnectDelay  time.Duration
+	RetryCalls      bool
+	Heartbeat       time.Duration
+	PongTimeout     time.Duration
+	Codecs          []Codec
 }
 
 func defaultUIConfig() *uiConfig {
@@ -92,6 +104,94 @@ func OpenURL(fn func(string) error) Option {
 	}
 }
 
+// OnPanic is called with the panic value when a bound function panics.
+// The panic is always recovered and returned to javascript as an internal error.
+func OnPanic(fn func(binding string, v interface{}, stack []byte)) Option {
+	return func(c *uiConfig) error {
+		c.OnPanic = fn
+		return nil
+	}
+}
+
+// Intercept appends interceptors which wrap every binding call.
+// Interceptors run in the order they are added.
+func Intercept(interceptors ...Interceptor) Option {
+	return func(c *uiConfig) error {
+		c.Interceptors = append(c.Interceptors, interceptors...)
+		return nil
+	}
+}
+
+// OnConnect is called when a session is connected and its bindings are ready.
+// It is not called again when a lost session is resumed by a reconnecting client.
+func OnConnect(fn func(*Session)) Option {
+	return func(c *uiConfig) error {
+		c.OnConnect = fn
+		return nil
+	}
+}
+
+// OnDisconnect is called when a session ends: it is closed by Session.Close, or its connection is lost
+// and the client does not resume it within the resume window, 30 seconds by default.
+func OnDisconnect(fn func(*Session)) Option {
+	return func(c *uiConfig) error {
+		c.OnDisconnect = fn
+		return nil
+	}
+}
+
+// SessionCookie keeps session state in a cookie with name, so that it survives page reloads.
+// The state is dropped when no session used it for ttl, 0 means 30 minutes.
+func SessionCookie(name string, ttl time.Duration) Option {
+	return func(c *uiConfig) error {
+		if name == "" {
+			return fmt.Errorf("session cookie name is empty")
+		}
+		c.SessionCookie = name
+		c.SessionTTL = ttl
+		return nil
+	}
+}
+
+// ResumeWindow is how long a lost session waits for its client to reconnect.
+// A resumed session keeps its bindings and state, negative duration disables resumption.
+func ResumeWindow(d time.Duration) Option {
+	return func(c *uiConfig) error {
+		c.ResumeWindow = d
+		return nil
+	}
+}
+
+// Reconnect controls how the client reconnects when the connection is lost.
+// maxDelay limits the backoff between attempts, 0 means 10 seconds and negative never reconnects.
+// Calls without a reply are resent after reconnect if retryCalls is true, otherwise they are rejected.
+func Reconnect(maxDelay time.Duration, retryCalls bool) Option {
+	return func(c *uiConfig) error {
+		c.ReconnectDelay = maxDelay
+		c.RetryCalls = retryCalls
+		return nil
+	}
+}
+
+// Heartbeat pings clients every interval, and closes a connection when its pong is not received within timeout.
+// Zero values mean 15 and 10 seconds, negative interval disables heartbeat.
+func Heartbeat(interval, timeout time.Duration) Option {
+	return func(c *uiConfig) error {
+		c.Heartbeat = interval
+		c.PongTimeout = timeout
+		return nil
+	}
+}
+
+// Codecs sets message codecs in preference order, like Codecs(MsgPackCodec).
+// JSONCodec is used when the client supports none of them.
+func Codecs(codecs ...Codec) Option {
+	return func(c *uiConfig) error {
+		c.Codecs = codecs
+		return nil
+	}
+}
+
 //
 // FileSystem Options
 //
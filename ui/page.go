@@ -3,28 +3,31 @@ package ui
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"reflect"
-
-	"golang.org/x/net/websocket"
 )
 
 // Page of a javascript client.
 type Page interface {
 	Bind(name string, f interface{}) error
 	Eval(js string) Value
+	EvalContext(ctx context.Context, js string) Value
+	Call(path string, args ...interface{}) Value
+	CallContext(ctx context.Context, path string, args ...interface{}) Value
+	Exposed() []string
+	Emit(topic string, payload interface{}) error
 	SetReady() error // nofity server ready ( all functions binded )
 	Close()
 	Done() <-chan struct{}
 }
 
 type page struct {
-	jsc *jsClient
+	jsc   *jsClient
+	uictx *UIContext // seen by interceptors
 }
 
-func newPage(ws *websocket.Conn) (*page, error) {
-	jsc, err := newJSClient(ws)
+func newPage(conn Transport, conf *connConfig) (*page, error) {
+	jsc, err := newJSClient(conn, conf)
 	if err != nil {
 		return nil, err
 	}
@@ -53,20 +56,67 @@ func (c *page) bindMap(items map[string]BindingFunc) error {
 
 	binds := map[string]bindingFunc{}
 	for name, f := range items {
+		name := name
 		v := reflect.ValueOf(f)
 		bindingFunc := func(raw []json.RawMessage) (interface{}, error) {
 			// Gots.call -> here(do the real call) -> eval for promise
-			if len(raw) != v.Type().NumIn() {
-				return nil, fmt.Errorf("function arguments mismatch")
+			fixed := numFixedIn(v.Type())
+			jsIn := jsParams(v.Type())
+			if len(raw) > len(jsIn) && !v.Type().IsVariadic() {
+				return nil, Errorf(CodeInvalidArgument, "function arguments mismatch")
+			}
+			for j := len(raw); j < len(jsIn); j++ {
+				if !isOptional(v.Type().In(jsIn[j])) {
+					return nil, Errorf(CodeInvalidArgument, "function arguments mismatch: argument %d is required", j)
+				}
+			}
+			n := fixed
+			if len(raw) > len(jsIn) {
+				n += len(raw) - len(jsIn)
+			}
+			// javascript argument of every parameter, nil for injected or missing ones
+			rawArgs := make([]json.RawMessage, n)
+			for j, r := range raw {
+				if j < len(jsIn) {
+					rawArgs[jsIn[j]] = r
+				} else {
+					rawArgs[fixed+j-len(jsIn)] = r
+				}
 			}
 			args := []reflect.Value{}
+			// released when the call returns, or when its stream result ends
+			var release cleanups
+			streaming := false
+			defer func() {
+				if !streaming {
+					release.run()
+				}
+			}()
 
 			// TODO: argumets rewrite
 			functionType := reflect.TypeOf((**Function)(nil))
 			contextType := reflect.TypeOf((*context.Context)(nil))
-			for i := range raw {
+			for i := 0; i < n; i++ {
+				if i < fixed && isInjected(v.Type().In(i)) {
+					args = append(args, c.inject(v.Type().In(i)))
+					continue
+				}
+
 				// ** process functionType and contxtType
-				arg := reflect.New(v.Type().In(i))
+				arg := reflect.New(paramType(v.Type(), i))
+				rawArg := rawArgs[i]
+				if rawArg == nil {
+					rawArg = json.RawMessage("null") // missing optional argument
+				}
+
+				if isBlobType(arg.Elem().Type()) {
+					blob, err := c.jsc.blobArg(arg.Elem().Type(), rawArg)
+					if err != nil {
+						return nil, NewError(CodeInvalidArgument, fmt.Sprintf("argument %d: %v", i, err), nil)
+					}
+					args = append(args, blob)
+					continue
+				}
 
 				isContext := false
 				if arg.Type() == contextType {
@@ -74,8 +124,8 @@ func (c *page) bindMap(items map[string]BindingFunc) error {
 					arg = reflect.New(reflect.TypeOf((*Context)(nil))) // rewrite context.Context interface to ui.Context type
 				}
 
-				if err := json.Unmarshal(raw[i], arg.Interface()); err != nil {
-					return nil, err
+				if err := json.Unmarshal(rawArg, arg.Interface()); err != nil {
+					return nil, NewError(CodeInvalidArgument, fmt.Sprintf("argument %d: %v", i, err), nil)
 				}
 
 				if isContext {
@@ -84,61 +134,145 @@ func (c *page) bindMap(items map[string]BindingFunc) error {
 						ctx = &Context{}
 						arg.Elem().Set(reflect.ValueOf(ctx))
 					}
-					cancel := ctx.WithCancel()
-					defer cancel()
+					cancel := ctx.withCancel(c.jsc.ctx)
 					c.jsc.ref(ctx.Seq, cancel)
-					defer c.jsc.unref(ctx.Seq)
+					seq := ctx.Seq
+					release = append(release, cancel, func() { c.jsc.unref(seq) })
 
 				} else if arg.Type() == functionType {
 					fn, _ := arg.Elem().Interface().(*Function)
 					if fn != nil {
-						fn.jsc = c.jsc
+						fn.attach(c.jsc)
 					}
-					defer fn.close()
+					release = append(release, fn.Release)
 				}
 				args = append(args, arg.Elem())
 			}
 
-			errorType := reflect.TypeOf((*error)(nil)).Elem()
-			res := v.Call(args)
-			switch len(res) {
-			case 0:
-				// no return value
-				return nil, nil
-			case 1:
-				// return value or error
-				if res[0].Type().Implements(errorType) {
-					if res[0].Interface() != nil {
-						return nil, res[0].Interface().(error)
-					}
-					return nil, nil
-				}
-				return res[0].Interface(), nil
-			case 2:
-				// first one is value, second is error
-				if !res[1].Type().Implements(errorType) {
-					return nil, errors.New("second return value must be an error")
+			call := &BindingCall{Name: name, Args: make([]interface{}, len(args)), Context: c.uictx}
+			for i, arg := range args {
+				call.Args[i] = arg.Interface()
+			}
+			invoke := func(call *BindingCall) (interface{}, error) {
+				n := numFixedIn(v.Type())
+				if len(call.Args) < n || (len(call.Args) > n && !v.Type().IsVariadic()) {
+					return nil, Errorf(CodeInvalidArgument, "function arguments mismatch")
 				}
-				if res[1].Interface() == nil {
-					return res[0].Interface(), nil
+				in := make([]reflect.Value, len(call.Args))
+				for i, arg := range call.Args {
+					t := paramType(v.Type(), i)
+					if arg == nil {
+						in[i] = reflect.Zero(t)
+						continue
+					}
+					in[i] = reflect.ValueOf(arg)
+					if !in[i].Type().AssignableTo(t) {
+						return nil, Errorf(CodeInvalidArgument, "argument %d: %T is not assignable to %v", i, arg, t)
+					}
 				}
-				return res[0].Interface(), res[1].Interface().(error)
-			default:
-				return nil, errors.New("unexpected number of return values")
+				return callResult(v.Call(in))
 			}
+
+			ret, err := chainInterceptors(c.jsc.conf.interceptors, invoke)(call)
+			if err != nil || ret == nil {
+				return ret, err
+			}
+			res := toResult(reflect.ValueOf(ret))
+			if s, ok := res.(*stream); ok {
+				s.release = release
+				streaming = true
+			}
+			return res, nil
 		}
 		binds[name] = bindingFunc
 	}
 	return c.jsc.bind(binds)
 }
 
+// inject fills a server-side parameter from the session.
+func (c *page) inject(t reflect.Type) reflect.Value {
+	var v interface{}
+	if uictx := c.uictx; uictx != nil {
+		switch t {
+		case uiContextType:
+			v = uictx
+		case requestType:
+			v = uictx.Request
+		case sessionType:
+			v = uictx.Session
+		}
+	}
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(v)
+}
+
+// callResult converts return values of a binding to (value, error).
+func callResult(res []reflect.Value) (interface{}, error) {
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	switch len(res) {
+	case 0:
+		// no return value
+		return nil, nil
+	case 1:
+		// return value or error
+		if res[0].Type().Implements(errorType) {
+			if res[0].Interface() != nil {
+				return nil, res[0].Interface().(error)
+			}
+			return nil, nil
+		}
+		return res[0].Interface(), nil
+	case 2:
+		// first one is value, second is error
+		if !res[1].Type().Implements(errorType) {
+			return nil, Errorf(CodeInternal, "second return value must be an error")
+		}
+		if res[1].Interface() == nil {
+			return res[0].Interface(), nil
+		}
+		return res[0].Interface(), res[1].Interface().(error)
+	default:
+		return nil, Errorf(CodeInternal, "unexpected number of return values")
+	}
+}
+
+// Eval evaluates js in the page, a returned Promise is awaited and its rejection is an error.
 func (c *page) Eval(js string) Value {
-	v, err := c.jsc.eval(js)
+	return c.EvalContext(context.Background(), js)
+}
+
+func (c *page) EvalContext(ctx context.Context, js string) Value {
+	v, err := c.jsc.eval(ctx, js)
 	return value{err: err, raw: v}
 }
 
+// Call invokes a function exposed by Gots.expose(name, fn), or a global function like "window.editor.setText".
+// Arguments are sent as json, a returned Promise is awaited.
+func (c *page) Call(path string, args ...interface{}) Value {
+	return c.CallContext(context.Background(), path, args...)
+}
+
+func (c *page) CallContext(ctx context.Context, path string, args ...interface{}) Value {
+	if _, err := json.Marshal(args); err != nil {
+		return value{err: err}
+	}
+	v, err := c.jsc.call(ctx, path, args)
+	return value{err: err, raw: v}
+}
+
+// Exposed lists names of functions exposed by Gots.expose.
+func (c *page) Exposed() []string {
+	return c.jsc.exposedNames()
+}
+
+func (c *page) Emit(topic string, payload interface{}) error {
+	return c.jsc.emit(topic, payload)
+}
+
 func (c *page) SetReady() error {
-	return c.jsc.ready()
+	return c.jsc.ready(nil)
 }
 
 func (c *page) Close() {
@@ -0,0 +1,380 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient is a Client which passes messages it does not handle to the test.
+type testClient struct {
+	*Client
+	t *testing.T
+}
+
+func newPipePage(t *testing.T, items map[string]BindingFunc) (*page, *testClient) {
+	server, conn := Pipe()
+	p, err := newPage(server, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	c := &testClient{Client: newClient(conn, make(chan msg, pipeBuffer)), t: t}
+	if err := p.bindMap(items); err != nil {
+		t.Fatal(err)
+	}
+	return p, c
+}
+
+// send writes a message as it is.
+func (c *testClient) send(method string, params interface{}) {
+	if err := c.write(h{"method": method, "params": params}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// recv waits for the next unhandled message, which must be of method.
+func (c *testClient) recv(method string) msg {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.unhandled:
+		if !ok {
+			c.t.Fatalf("disconnected before %s", method)
+		}
+		if m.Method != method {
+			c.t.Fatalf("got %s %s, want %s", m.Method, m.Params, method)
+		}
+		return m
+	case <-time.After(2 * time.Second):
+		c.t.Fatalf("timeout waiting for %s", method)
+	}
+	return msg{}
+}
+
+// call invokes a binding and waits for its result.
+func (c *testClient) call(name string, args ...interface{}) Value {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return c.Call(ctx, name, args...)
+}
+
+// errCode returns the code of a binding error.
+func errCode(v Value) string {
+	if e, ok := v.Err().(*Error); ok {
+		return e.Code
+	}
+	return ""
+}
+
+// pipeRet is a Gots.ret of a call sent by send.
+type pipeRet struct {
+	Seq    int             `json:"seq"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func TestPageCall(t *testing.T) {
+	_, c := newPipePage(t, map[string]BindingFunc{
+		"sum":  func(a, b int) int { return a + b },
+		"find": func(id int) (string, error) { return "", NewError(CodeNotFound, "no such item", id) },
+		"boom": func() { panic("boom") },
+	})
+
+	if v := c.call("sum", 1, 2); v.Err() != nil || v.Int() != 3 {
+		t.Errorf("sum = %v %v", v.Int(), v.Err())
+	}
+	if v := c.call("find", 7); errCode(v) != CodeNotFound || v.Err().(*Error).Details != 7.0 {
+		t.Errorf("find error = %v", v.Err())
+	}
+	if v := c.call("sum", 1); errCode(v) != CodeInvalidArgument {
+		t.Errorf("missing argument error = %v", v.Err())
+	}
+	if v := c.call("boom"); errCode(v) != CodeInternal {
+		t.Errorf("panic error = %v", v.Err())
+	}
+	if v := c.call("nope"); errCode(v) != CodeNotFound {
+		t.Errorf("unknown binding error = %v", v.Err())
+	}
+}
+
+func TestPagePanicHook(t *testing.T) {
+	p, c := newPipePage(t, map[string]BindingFunc{"boom": func() { panic("boom") }})
+	reported := make(chan interface{}, 1)
+	p.jsc.conf.onPanic = func(binding string, v interface{}, stack []byte) {
+		reported <- v
+		panic("hook")
+	}
+
+	if v := c.call("boom"); errCode(v) != CodeInternal {
+		t.Errorf("panic error = %v", v.Err())
+	}
+	if v := <-reported; v != "boom" {
+		t.Errorf("reported %v", v)
+	}
+}
+
+func TestPageCallback(t *testing.T) {
+	_, c := newPipePage(t, map[string]BindingFunc{
+		"twice": func(fn *Function) (int, error) {
+			v := fn.Call(21)
+			return v.Int() * 2, v.Err()
+		},
+	})
+
+	got := make(chan string, 1)
+	cb := NewCallback(func(args []json.RawMessage) (interface{}, error) {
+		data, _ := json.Marshal(args)
+		got <- string(data)
+		return 42, nil
+	})
+	if v := c.call("twice", cb); v.Err() != nil || v.Int() != 84 {
+		t.Errorf("twice = %v %v", v.Int(), v.Err())
+	}
+	if args := <-got; args != "[21]" {
+		t.Errorf("callback args = %s", args)
+	}
+	select {
+	case <-cb.Closed():
+	case <-time.After(2 * time.Second):
+		t.Error("callback is not closed when the call returns")
+	}
+}
+
+func TestPageContext(t *testing.T) {
+	started := make(chan bool, 1)
+	ended := make(chan error, 2)
+	hasDeadline := make(chan bool, 1)
+	p, c := newPipePage(t, map[string]BindingFunc{
+		"wait": func(ctx context.Context) error {
+			started <- true
+			<-ctx.Done()
+			ended <- ctx.Err()
+			return ctx.Err()
+		},
+		"deadline": func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			hasDeadline <- ok
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ret := make(chan Value, 1)
+	go func() { ret <- c.call("wait", ctx) }()
+	<-started
+	cancel()
+	if v := <-ret; errCode(v) != CodeCanceled {
+		t.Errorf("canceled error = %v", v.Err())
+	}
+	<-ended
+
+	// a javascript deadline expires the context
+	c.send("Gots.call", h{"name": "deadline", "seq": 1, "args": []interface{}{h{"seq": 100, "timeout": 20}}})
+	if !<-hasDeadline {
+		t.Errorf("no deadline")
+	}
+	deadline := pipeRet{}
+	json.Unmarshal(c.recv("Gots.ret").Params, &deadline)
+	if deadline.Error == nil || deadline.Error.Code != CodeDeadlineExceeded {
+		t.Errorf("deadline error = %+v", deadline.Error)
+	}
+
+	// a disconnect cancels running calls
+	go c.call("wait", nil)
+	<-started
+	c.Close()
+	select {
+	case err := <-ended:
+		if err != context.Canceled {
+			t.Errorf("ctx err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("running call is not canceled after the client is closed")
+	}
+	<-p.Done()
+}
+
+type pageLimit struct {
+	Optional
+	Max int `json:"max"`
+}
+
+func TestPageCallArguments(t *testing.T) {
+	_, c := newPipePage(t, map[string]BindingFunc{
+		"format": fmt.Sprintf,
+		"find": func(name string, limit *int) string {
+			if limit == nil {
+				return name + " all"
+			}
+			return fmt.Sprintf("%s %d", name, *limit)
+		},
+		"list": func(name string, limit pageLimit) string { return fmt.Sprintf("%s %d", name, limit.Max) },
+	})
+
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{"format", []interface{}{"%s=%v", "a", 1}, "a=1"},
+		{"format", []interface{}{"plain"}, "plain"},
+		{"find", []interface{}{"x", 2}, "x 2"},
+		{"find", []interface{}{"x"}, "x all"},
+		{"find", []interface{}{"x", nil}, "x all"},
+		{"list", []interface{}{"x", h{"max": 3}}, "x 3"},
+		{"list", []interface{}{"x"}, "x 0"},
+	} {
+		if v := c.call(tc.name, tc.args...); v.String() != tc.want || v.Err() != nil {
+			t.Errorf("%s%v = %s %v, want %s", tc.name, tc.args, v.String(), v.Err(), tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+	}{
+		{"format", nil},
+		{"find", nil},
+		{"list", nil},
+		{"find", []interface{}{"x", 1, 2}},
+	} {
+		v := c.call(tc.name, tc.args...)
+		if errCode(v) != CodeInvalidArgument {
+			t.Errorf("%s%v error = %v", tc.name, tc.args, v.Err())
+		} else if tc.args == nil && !strings.Contains(v.Err().Error(), "argument 0 is required") {
+			t.Errorf("%s%v error = %v", tc.name, tc.args, v.Err())
+		}
+	}
+}
+
+func TestPageInject(t *testing.T) {
+	var gotReq *http.Request
+	var gotSess *Session
+	p, c := newPipePage(t, map[string]BindingFunc{
+		"whoami": func(r *http.Request, sess *Session, greeting string) string {
+			gotReq, gotSess = r, sess
+			return greeting
+		},
+	})
+	req := httptest.NewRequest("GET", "/app", nil)
+	sess := newSession(req, newState("test"))
+	sess.uictx = &UIContext{Request: req, Session: sess}
+	sess.attach(p)
+
+	// the first javascript argument goes to greeting
+	if v := c.call("whoami", "hi"); v.String() != "hi" || v.Err() != nil {
+		t.Errorf("whoami = %s %v", v.String(), v.Err())
+	}
+	if gotReq != req || gotSess != sess {
+		t.Errorf("injected %v %v, want the request and session", gotReq, gotSess)
+	}
+	if v := c.call("whoami", "hi", "extra"); errCode(v) != CodeInvalidArgument {
+		t.Errorf("extra argument error = %v", v.Err())
+	}
+}
+
+func TestPageEmit(t *testing.T) {
+	p, c := newPipePage(t, nil)
+	if err := p.Emit("tick", []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Emit("bad", func() {}); err == nil {
+		t.Errorf("emit of a func succeeds")
+	}
+	if err := p.Emit("end", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`tick [1,2]`, `end null`} {
+		if m := c.recvEmit(); m.Topic+" "+string(m.Payload) != want {
+			t.Errorf("emit = %s %s, want %s", m.Topic, m.Payload, want)
+		}
+	}
+}
+
+// serverCall is a Gots.call sent by Page.Eval and Page.Call.
+type serverCall struct {
+	Name string            `json:"name"`
+	Path string            `json:"path"`
+	Args []json.RawMessage `json:"args"`
+}
+
+func (c *testClient) recvCall() (int, serverCall) {
+	c.t.Helper()
+	m := c.recv("Gots.call")
+	call := serverCall{}
+	json.Unmarshal(m.Params, &call)
+	return m.ID, call
+}
+
+func TestPageEval(t *testing.T) {
+	p, c := newPipePage(t, nil)
+
+	ret := make(chan Value, 1)
+	go func() { ret <- p.Eval("fetchName()") }()
+	id, call := c.recvCall()
+	if call.Name != "eval" || len(call.Args) != 1 || string(call.Args[0]) != `"fetchName()"` {
+		t.Errorf("eval envelope = %+v", call)
+	}
+	c.reply(id, "ada", nil)
+	if v := <-ret; v.Err() != nil || v.String() != "ada" {
+		t.Errorf("eval = %v %v", v.String(), v.Err())
+	}
+
+	// a rejected promise is an error
+	go func() { ret <- p.Eval("Promise.reject('nope')") }()
+	id, _ = c.recvCall()
+	c.reply(id, nil, errors.New("nope"))
+	if v := <-ret; v.Err() == nil || v.Err().Error() != "nope" {
+		t.Errorf("rejected eval error = %v", v.Err())
+	}
+}
+
+func TestPageCallExposed(t *testing.T) {
+	p, c := newPipePage(t, nil)
+
+	// args are sent as json, not as javascript source
+	ret := make(chan Value, 1)
+	go func() { ret <- p.Call("window.editor.setText", "a'); alert('b", 2) }()
+	id, call := c.recvCall()
+	if call.Name != "call" || call.Path != "window.editor.setText" || len(call.Args) != 2 ||
+		string(call.Args[0]) != `"a'); alert('b"` || string(call.Args[1]) != "2" {
+		t.Errorf("call envelope = %+v", call)
+	}
+	c.reply(id, true, nil)
+	if v := <-ret; v.Err() != nil || !v.Bool() {
+		t.Errorf("call = %v %v", v.Bool(), v.Err())
+	}
+	if v := p.Call("f", func() {}); v.Err() == nil {
+		t.Errorf("call with a func argument succeeds")
+	}
+
+	// functions exposed by the page
+	c.Expose("double", func(args []json.RawMessage) (interface{}, error) {
+		var n int
+		json.Unmarshal(args[0], &n)
+		return 2 * n, nil
+	})
+	if v := p.Call("double", 21); v.Err() != nil || v.Int() != 42 {
+		t.Errorf("double = %v %v", v.Int(), v.Err())
+	}
+	if names := p.Exposed(); len(names) != 1 || names[0] != "double" {
+		t.Errorf("exposed = %v", names)
+	}
+	c.Unexpose("double")
+	go func() { ret <- p.Call("double", 1) }()
+	id, _ = c.recvCall()
+	c.reply(id, nil, errors.New("double is not a function"))
+	if v := <-ret; v.Err() == nil || v.Err().Error() != "double is not a function" {
+		t.Errorf("call error = %v", v.Err())
+	}
+	if names := p.Exposed(); len(names) != 0 {
+		t.Errorf("exposed after unexpose = %v", names)
+	}
+}
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy authorizes a session to use some bindings, a non-nil error denies access.
+//
+// Policies also decide which bindings are listed by gots.js and gots.d.ts,
+// Session and Done of c are nil for those requests, only Request is set.
+type Policy func(c *UIContext) error
+
+// Require guards bindings with a policy.
+// The policy runs when a session connects, denied bindings are hidden from the session,
+// and it runs again before every call.
+//
+// Returned by a Delay factory, the policy runs once when the bindings of a session are created.
+func Require(policy Policy, b Bindings) Bindings {
+	if policy == nil {
+		return &mapBinding{err: fmt.Errorf("bind require: policy is nil")}
+	}
+	return &requireBinding{policy: policy, Bindings: b}
+}
+
+type requireBinding struct {
+	policy Policy
+	Bindings
+}
+
+func (r *requireBinding) Map(c *UIContext) map[string]BindingFunc {
+	if c != nil && r.policy(c) != nil {
+		return nil
+	}
+	return r.Bindings.Map(c)
+}
+
+func (r *requireBinding) prototypes() map[string]BindingFunc {
+	return getPrototypes(r.Bindings)
+}
+
+func (r *requireBinding) policies() map[string][]Policy {
+	ret := getPolicies(r.Bindings)
+	for _, name := range r.Names() {
+		ret[name] = append(ret[name], r.policy)
+	}
+	return ret
+}
+
+// policyHolder is implemented by bindings guarded by policies.
+type policyHolder interface {
+	policies() map[string][]Policy
+}
+
+// getPolicies returns policies of b by binding name.
+func getPolicies(b Bindings) map[string][]Policy {
+	if p, ok := b.(policyHolder); ok {
+		return p.policies()
+	}
+	return map[string][]Policy{}
+}
+
+// authorize runs all policies, errors without a code are reported as permission denied.
+func authorize(policies []Policy, c *UIContext) error {
+	for _, policy := range policies {
+		err := policy(c)
+		if err == nil {
+			continue
+		}
+		var coded CodedError
+		if errors.As(err, &coded) {
+			return err
+		}
+		return NewError(CodePermissionDenied, err.Error(), nil)
+	}
+	return nil
+}
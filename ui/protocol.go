@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Protocol versions of the wire format between gots.js and the server.
+//
+// Version 1 is a client without Gots.hello, it gets no optional feature.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// Optional features negotiated by Gots.hello.
+const (
+	FeatureStream    = "stream"    // channel results as Gots.yield and Gots.end
+	FeatureResume    = "resume"    // reconnect with a resume token
+	FeatureHeartbeat = "heartbeat" // answer Gots.ping
+	FeatureBinary    = "binary"    // []byte and io.Reader as binary frames
+)
+
+var serverFeatures = []string{FeatureStream, FeatureResume, FeatureHeartbeat, FeatureBinary}
+
+// helloTimeout is how long the server waits for Gots.hello from a client which announces
+// its protocol in the connection url, like ?protocol=2. Other clients are version 1.
+var helloTimeout = 3 * time.Second
+
+// helloWait returns how long to wait for Gots.hello of a client connected by r.
+func helloWait(r *http.Request) time.Duration {
+	if r == nil || r.URL.Query().Get("protocol") == "" {
+		return 0
+	}
+	return helloTimeout
+}
+
+type helloParams struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+	Codecs   []string `json:"codecs"` // supported by the client, JSONCodec is assumed
+}
+
+// negotiate picks the protocol version and features supported by both sides.
+func negotiate(hello helloParams) (int, []string, error) {
+	if hello.Version > ProtocolVersion {
+		return 0, nil, NewError(CodeFailedPrecondition, "incompatible gots protocol: client is newer than server, reload the page or upgrade the server",
+			h{"client": hello.Version, "server": ProtocolVersion})
+	}
+	if hello.Version < MinProtocolVersion {
+		return 0, nil, NewError(CodeFailedPrecondition, "incompatible gots protocol: client is too old, reload the page",
+			h{"client": hello.Version, "server": ProtocolVersion})
+	}
+	supported := map[string]bool{}
+	for _, name := range serverFeatures {
+		supported[name] = true
+	}
+	features := []string{}
+	for _, name := range hello.Features {
+		if supported[name] {
+			features = append(features, name)
+			delete(supported, name)
+		}
+	}
+	sort.Strings(features)
+	return hello.Version, features, nil
+}
+
+// handshake waits for Gots.hello and replies the negotiated protocol.
+// A client which has not sent Gots.hello within timeout is version 1, it is not waited for when timeout is 0.
+// An incompatible client is told the reason and disconnected.
+func (p *jsClient) handshake(timeout time.Duration) error {
+	hello := helloParams{Version: 1}
+	select {
+	case hello = <-p.hello:
+	case <-p.done:
+		return ErrDisconnected
+	default:
+		if timeout <= 0 {
+			break
+		}
+		select {
+		case hello = <-p.hello:
+		case <-time.After(timeout):
+		case <-p.done:
+			return ErrDisconnected
+		}
+	}
+
+	version, features, err := negotiate(hello)
+	if err != nil {
+		p.send("Gots.hello", h{"error": toError(err)}, false)
+		p.send("Gots.close", nil, false)
+		p.cancel()
+		return err
+	}
+
+	p.Lock()
+	p.version = version
+	p.features = map[string]bool{}
+	for _, name := range features {
+		p.features[name] = true
+	}
+	p.Unlock()
+
+	if version == 1 {
+		return nil
+	}
+	// the client may reply in the codec as soon as it receives Gots.hello
+	codec := pickCodec(p.conf.codecs, hello.Codecs)
+	p.Lock()
+	p.codec = codec
+	p.Unlock()
+	_, err = p.send("Gots.hello", h{"version": version, "features": features, "codec": codec.Name()}, false)
+	return err
+}
+
+// supports reports whether a feature is negotiated.
+func (p *jsClient) supports(feature string) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.features[feature]
+}
+
+func (p *jsClient) protocol() (int, []string) {
+	p.Lock()
+	defer p.Unlock()
+	features := []string{}
+	for name := range p.features {
+		features = append(features, name)
+	}
+	sort.Strings(features)
+	return p.version, features
+}
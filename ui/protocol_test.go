@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	version, features, err := negotiate(helloParams{Version: 2, Features: []string{"heartbeat", "future", "stream"}})
+	if err != nil || version != 2 || !reflect.DeepEqual(features, []string{"heartbeat", "stream"}) {
+		t.Errorf("negotiate = %d %v %v", version, features, err)
+	}
+	if version, features, err = negotiate(helloParams{Version: 1}); err != nil || version != 1 || len(features) != 0 {
+		t.Errorf("legacy client = %d %v %v", version, features, err)
+	}
+	_, _, err = negotiate(helloParams{Version: ProtocolVersion + 1})
+	if e := toError(err); e.Code != CodeFailedPrecondition {
+		t.Errorf("newer client error = %v", err)
+	}
+}
+
+func TestScriptProtocol(t *testing.T) {
+	want := fmt.Sprintf("const protocol = { version: %d, features: [\"%s\"], ", ProtocolVersion, strings.Join(serverFeatures, "\", \""))
+	if !strings.Contains(script, want) {
+		t.Errorf("script protocol does not match server, want: %s", want)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	if helloWait(httptest.NewRequest("GET", "/gots", nil)) != 0 {
+		t.Errorf("waits for a version 1 client")
+	}
+	if helloWait(httptest.NewRequest("GET", "/gots?protocol=2", nil)) != helloTimeout {
+		t.Errorf("does not wait for a client which announces its protocol")
+	}
+
+	// version 1 is not waited for
+	p, _ := newPipePage(t, map[string]BindingFunc{"sum": sum})
+	start := time.Now()
+	if err := p.jsc.handshake(0); err != nil || time.Since(start) > time.Second {
+		t.Fatalf("handshake = %v after %v", err, time.Since(start))
+	}
+	if version, features := p.jsc.protocol(); version != 1 || len(features) != 0 {
+		t.Errorf("protocol = %d %v", version, features)
+	}
+
+	// Gots.hello is answered as soon as it arrives
+	p, c := newPipePage(t, map[string]BindingFunc{"sum": sum})
+	c.send("Gots.hello", h{"version": ProtocolVersion, "features": []string{FeatureStream}})
+	if err := p.jsc.handshake(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	c.recv("Gots.hello")
+	if !p.jsc.supports(FeatureStream) {
+		t.Errorf("stream is not negotiated")
+	}
+}
@@ -7,13 +7,15 @@ import (
 )
 
 type jsOption struct {
-	Dev           bool     `json:"dev"`
-	TLS           bool     `json:"tls"`
-	ReadyFuncName string   `json:"readyFuncName"`
-	Prefix        string   `json:"prefix"`
-	Search        string   `json:"search"`
-	Bindings      []string `json:"bindings"`
-	BlurOnClose   bool     `json:"blurOnClose"`
+	Dev            bool     `json:"dev"`
+	TLS            bool     `json:"tls"`
+	ReadyFuncName  string   `json:"readyFuncName"`
+	Prefix         string   `json:"prefix"`
+	Search         string   `json:"search"`
+	Bindings       []string `json:"bindings"`
+	BlurOnClose    bool     `json:"blurOnClose"`
+	ReconnectDelay int      `json:"reconnectDelay"` // milliseconds
+	RetryCalls     bool     `json:"retryCalls"`
 }
 
 func injectOptions(op *jsOption) string {
@@ -43,6 +45,7 @@ func mapScript(in, old, new string) string {
 	return ret
 }
 
+// script is compiled from cmd/a.out/fe/src/app.ts, edit both together.
 var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _arguments, P, generator) {
     function adopt(value) { return value instanceof P ? value : new P(function (resolve) { resolve(value); }); }
     return new (P || (P = Promise))(function (resolve, reject) {
@@ -64,25 +67,113 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
             prefix: "",
             search: "?name=api",
             bindings: [],
-            blurOnClose: true
+            blurOnClose: true,
+            reconnectDelay: 0,
+            retryCalls: false
         };
     }
     let dev = options.dev;
+    // wire protocol of this script, negotiated by Gots.hello
+    const protocol = { version: 2, features: ["stream", "resume", "heartbeat", "binary"], codecs: ["msgpack", "json"] };
+    const blobChunkSize = 1 << 20;
+    // GotsError is a Go error: { code, message, details, stack }
+    class GotsError extends Error {
+        constructor(e) {
+            super(e.message);
+            this.name = "GotsError";
+            this.code = e.code;
+            this.details = e.details;
+            if (e.stack)
+                this.goStack = e.stack;
+        }
+    }
+    function toError(e) {
+        if (typeof e === "string")
+            return new GotsError({ code: "unknown", message: e });
+        return new GotsError(e);
+    }
+    // Stream is an async iterable of a Go channel result.
+    class Stream {
+        constructor(oncancel) {
+            this.oncancel = oncancel;
+            this.values = [];
+            this.waiters = [];
+            this.done = false;
+            this.error = null;
+        }
+        push(value) {
+            if (this.done)
+                return;
+            if (this.waiters.length > 0)
+                this.waiters.shift().resolve({ value, done: false });
+            else
+                this.values.push(value);
+        }
+        end(error) {
+            if (this.done)
+                return;
+            this.done = true;
+            this.error = error || null;
+            for (const waiter of this.waiters.splice(0)) {
+                if (this.error)
+                    waiter.reject(this.error);
+                else
+                    waiter.resolve({ value: undefined, done: true });
+            }
+        }
+        next() {
+            if (this.values.length > 0)
+                return Promise.resolve({ value: this.values.shift(), done: false });
+            if (this.done)
+                return this.error ? Promise.reject(this.error) : Promise.resolve({ value: undefined, done: true });
+            return new Promise((resolve, reject) => this.waiters.push({ resolve, reject }));
+        }
+        return() {
+            this.values = [];
+            if (!this.done)
+                this.oncancel();
+            this.end();
+            return Promise.resolve({ value: undefined, done: true });
+        }
+        [Symbol.asyncIterator]() {
+            return this;
+        }
+    }
     class Gots {
-        constructor(ws) {
-            this.ws = ws;
+        constructor(url) {
+            this.url = url;
+            this.ws = null;
             this.resolveAPI = null;
+            this.rejectAPI = null;
+            this.fatal = null; // error which stops the client, like an incompatible protocol
+            this.protocol = null; // negotiated { version, features }
             this.lastRefID = 0;
             this.beforeReady = null;
+            this.listeners = new Map();
+            this.exposed = new Map();
+            this.bound = new Set();
+            this.inflight = new Map(); // "name#seq" -> { name, seq, text, sent }
+            this.token = null; // resume token of the server session
+            this.online = false; // connected and bindings are ready
+            this.everReady = false;
+            this.closed = false; // closed by server
+            this.attempts = 0;
+            this.lastBlobID = 0;
+            this.chunks = new Map(); // blob id -> received chunks
+            this.blobs = new Map(); // blob id -> received Uint8Array
+            this.heartbeat = 0; // close a connection silent for milliseconds
+            this.watchdog = null;
             this.buildRoot();
-            this.attach();
             this.initContext();
+            this.connect();
         }
         buildRoot() {
             let root = {};
             const ready = new Promise((resolve, reject) => {
                 this.resolveAPI = resolve;
+                this.rejectAPI = reject;
             });
+            ready.catch(() => { }); // rejected for an incompatible server, seen by callers
             // root[options.readyFuncName] = () => ready;
             root[options.readyFuncName] = {};
             for (const name of options.bindings) {
@@ -104,6 +195,38 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
         }
         extendGots(Gots) {
             Gots.self = this;
+            Gots.Error = GotsError;
+            // server push events
+            Gots.on = (topic, handler) => {
+                let handlers = this.listeners.get(topic);
+                if (!handlers) {
+                    handlers = new Set();
+                    this.listeners.set(topic, handlers);
+                }
+                handlers.add(handler);
+                return () => Gots.off(topic, handler);
+            };
+            // functions callable from go by name
+            Gots.expose = (name, fn) => {
+                this.exposed.set(name, fn);
+                this.sendexposed("Gots.expose", [name]);
+                return () => Gots.unexpose(name);
+            };
+            Gots.unexpose = (name) => {
+                if (this.exposed.delete(name))
+                    this.sendexposed("Gots.unexpose", [name]);
+            };
+            Gots.off = (topic, handler) => {
+                const handlers = this.listeners.get(topic);
+                if (!handlers)
+                    return;
+                if (handler === undefined)
+                    handlers.clear();
+                else
+                    handlers.delete(handler);
+                if (handlers.size === 0)
+                    this.listeners.delete(topic);
+            };
         }
         getapi() {
             return this.root;
@@ -121,11 +244,83 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                     error: err
                 }
             };
-            this.ws.send(JSON.stringify(msg));
+            let data;
+            try {
+                data = this.encode(msg);
+            }
+            catch (ex) {
+                msg.params = { result: null, error: errorString(ex) };
+                data = this.encode(msg);
+            }
+            this.send(data);
+        }
+        // encode a message with the negotiated codec
+        encode(msg) {
+            if (this.codec !== "msgpack")
+                return JSON.stringify(msg);
+            const packer = new Packer();
+            packer.byte(0xff);
+            packer.pack(msg, "");
+            return packer.buf.subarray(0, packer.off);
+        }
+        // messages are dropped when the socket is not open
+        send(data) {
+            if (this.ws.readyState !== 1)
+                return false;
+            this.ws.send(data);
+            return true;
+        }
+        sendexposed(method, names) {
+            // all names are sent on open
+            this.send(this.encode({ method, params: { names } }));
+        }
+        // invoke an exposed function or a global function by its dotted path
+        invoke(path, args) {
+            const fn = this.exposed.get(path);
+            if (fn)
+                return fn(...args);
+            let target = window, self;
+            for (const part of path.split(".")) {
+                if (target === undefined || target === null)
+                    throw new Error("function not found: " + path);
+                self = target;
+                target = target[part];
+            }
+            if (typeof target !== "function")
+                throw new Error("not a function: " + path);
+            return target.apply(self, args);
+        }
+        // reply the result of fn, a thenable result is awaited
+        replyresult(id, fn) {
+            let ret;
+            try {
+                ret = fn();
+            }
+            catch (ex) {
+                this.replymessage(id, undefined, errorString(ex));
+                return;
+            }
+            if (ret !== null && (typeof ret === "object" || typeof ret === "function") && typeof ret.then === "function") {
+                Promise.resolve(ret).then(value => this.replymessage(id, value), ex => this.replymessage(id, undefined, errorString(ex)));
+                return;
+            }
+            this.replymessage(id, ret);
         }
         onmessage(e) {
             let ws = this.ws;
-            let msg = JSON.parse(e.data);
+            let msg;
+            if (typeof e.data === "string")
+                msg = JSON.parse(e.data);
+            else {
+                const bytes = new Uint8Array(e.data);
+                if (bytes[0] !== 0xff) {
+                    this.alive();
+                    this.putchunk(bytes);
+                    return;
+                }
+                msg = new Unpacker(bytes.subarray(1)).value();
+            }
+            this.alive();
             if (dev)
                 console.log("receive: ", JSON.stringify(msg, null, "  "));
             let root = this.root;
@@ -136,41 +331,62 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                     params = msg.params;
                     switch (params.name) {
                         case "eval": {
-                            let ret, err;
-                            try {
-                                ret = eval(params.args[0]);
-                            }
-                            catch (ex) {
-                                err = ex.toString() || "unknown error";
-                            }
-                            this.replymessage(msg.id, ret, err);
+                            this.replyresult(msg.id, () => eval(params.args[0]));
+                            break;
+                        }
+                        case "call": {
+                            this.replyresult(msg.id, () => this.invoke(params.path, params.args || []));
                             break;
                         }
                     }
                     break;
                 }
                 case "Gots.ret": {
-                    let { name, seq, result, error } = msg.params;
+                    let { name, seq, result, error, stream } = msg.params;
+                    this.inflight.delete(name + "#" + seq);
+                    if (!root[name] || !root[name]["results"] || !root[name]["results"].has(seq))
+                        break; // settled when the connection was lost
                     if (error) {
-                        root[name]["errors"].get(seq)(error);
+                        root[name]["errors"].get(seq)(toError(error));
+                    }
+                    else if (stream) {
+                        let streams = root[name]["streams"];
+                        if (!streams) {
+                            streams = new Map();
+                            root[name]["streams"] = streams;
+                        }
+                        const s = new Stream(() => {
+                            streams.delete(seq);
+                            this.send(this.encode({ method: "Gots.cancel", params: { name, seq } }));
+                        });
+                        streams.set(seq, s);
+                        root[name]["results"].get(seq)(s);
                     }
                     else {
-                        root[name]["results"].get(seq)(result);
+                        root[name]["results"].get(seq)(this.fromblob(result));
                     }
                     root[name]["errors"].delete(seq);
                     root[name]["results"].delete(seq);
                     break;
                 }
+                case "Gots.yield": {
+                    let { name, seq, value } = msg.params;
+                    const s = root[name]["streams"].get(seq);
+                    if (s)
+                        s.push(value);
+                    break;
+                }
+                case "Gots.end": {
+                    let { name, seq, error } = msg.params;
+                    const s = root[name]["streams"].get(seq);
+                    if (s)
+                        s.end(error && toError(error));
+                    root[name]["streams"].delete(seq);
+                    break;
+                }
                 case "Gots.callback": {
                     let { name, seq, args } = msg.params;
-                    let ret, err;
-                    try {
-                        ret = root[name]["callbacks"].get(seq)(...args);
-                    }
-                    catch (ex) {
-                        err = ex.toString() || "unknown error";
-                    }
-                    this.replymessage(msg.id, ret, err);
+                    this.replyresult(msg.id, () => root[name]["callbacks"].get(seq)(...args));
                     break;
                 }
                 case "Gots.closeCallback": {
@@ -178,6 +394,21 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                     root[name]["callbacks"].delete(seq);
                     break;
                 }
+                case "Gots.emit": {
+                    let { topic, payload } = msg.params;
+                    const handlers = this.listeners.get(topic);
+                    if (!handlers)
+                        break;
+                    for (const handler of [...handlers]) {
+                        try {
+                            handler(payload);
+                        }
+                        catch (ex) {
+                            console.error("event handler error:", topic, ex);
+                        }
+                    }
+                    break;
+                }
                 case "Gots.bind": {
                     params = msg.params;
                     if (Array.isArray(params.name))
@@ -187,43 +418,221 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                         this.bind(params.name);
                     break;
                 }
+                case "Gots.hello": {
+                    const { error, version, features } = msg.params;
+                    if (error) {
+                        this.fatal = toError(error);
+                        this.closed = true;
+                        console.error("gots:", this.fatal.message, this.fatal.details);
+                        if (this.rejectAPI != null)
+                            this.rejectAPI(this.fatal);
+                        break;
+                    }
+                    this.protocol = { version, features };
+                    // following messages are encoded by the codec
+                    this.codec = msg.params.codec || "json";
+                    break;
+                }
+                case "Gots.ping": {
+                    this.replymessage(msg.id, null);
+                    break;
+                }
                 case "Gots.ready": {
+                    const { session, heartbeat } = msg.params || {};
+                    this.token = session || null;
+                    this.heartbeat = heartbeat || 0;
+                    this.alive();
+                    this.online = true;
+                    this.everReady = true;
+                    this.attempts = 0;
                     if (this.beforeReady !== null) {
                         this.beforeReady();
                     }
                     if (this.resolveAPI != null) {
                         this.resolveAPI();
                     }
+                    this.flush();
+                    break;
+                }
+                case "Gots.close": {
+                    this.closed = true;
                     break;
                 }
             }
         }
+        connect() {
+            // the server waits for Gots.hello only when the url announces it
+            let url = this.url + "?protocol=" + protocol.version;
+            if (this.token)
+                url += "&resume=" + encodeURIComponent(this.token);
+            this.codec = "json"; // until Gots.hello
+            this.ws = new WebSocket(url);
+            this.ws.binaryType = "arraybuffer";
+            this.attach();
+        }
+        reconnect() {
+            if (this.closed || options.reconnectDelay < 0)
+                return;
+            const max = options.reconnectDelay || 10000;
+            const delay = Math.min(max, 250 * Math.pow(2, this.attempts++));
+            setTimeout(() => this.connect(), delay * (0.5 + Math.random() / 2));
+        }
+        // settle calls and streams of the lost connection
+        lost() {
+            const err = this.fatal || new GotsError({ code: "unavailable", message: "connection lost" });
+            this.chunks.clear();
+            for (const [key, call] of this.inflight) {
+                if (this.retry()) {
+                    call.sent = false;
+                    continue;
+                }
+                this.inflight.delete(key);
+                this.settle(call.name, call.seq, err);
+            }
+            for (const name of this.bound) {
+                const streams = this.root[name]["streams"];
+                if (!streams)
+                    continue;
+                for (const s of streams.values())
+                    s.end(err);
+                streams.clear();
+            }
+        }
+        // calls are kept for the next connection before the first ready or with retryCalls
+        retry() {
+            return !this.everReady || (options.retryCalls && !this.closed && options.reconnectDelay >= 0);
+        }
+        settle(name, seq, err) {
+            const me = this.root[name];
+            const reject = me["errors"].get(seq);
+            me["errors"].delete(seq);
+            me["results"].delete(seq);
+            if (reject)
+                reject(err);
+        }
+        // send calls waiting for a connection
+        flush() {
+            for (const call of this.inflight.values()) {
+                if (!call.sent)
+                    call.sent = this.sendcall(call);
+            }
+        }
+        supports(feature) {
+            return this.protocol !== null && (this.protocol.features || []).indexOf(feature) !== -1;
+        }
+        // blobs of a call are sent as binary frames before the call message
+        sendcall(call) {
+            if (this.ws.readyState !== 1)
+                return false;
+            for (const { id, bytes } of call.blobs) {
+                for (let off = 0;; off += blobChunkSize) {
+                    const end = Math.min(off + blobChunkSize, bytes.length);
+                    const chunk = new Uint8Array(5 + end - off);
+                    new DataView(chunk.buffer).setUint32(0, id);
+                    chunk[4] = end === bytes.length ? 1 : 0;
+                    chunk.set(bytes.subarray(off, end), 5);
+                    this.ws.send(chunk);
+                    if (chunk[4] === 1)
+                        break;
+                }
+            }
+            if (call.codec !== this.codec) {
+                call.codec = this.codec;
+                call.data = this.encode(call.msg);
+            }
+            this.ws.send(call.data);
+            return true;
+        }
+        putchunk(chunk) {
+            const id = new DataView(chunk.buffer, chunk.byteOffset).getUint32(0);
+            let chunks = this.chunks.get(id);
+            if (!chunks) {
+                chunks = [];
+                this.chunks.set(id, chunks);
+            }
+            chunks.push(chunk.subarray(5));
+            if (chunk[4] !== 1)
+                return;
+            this.chunks.delete(id);
+            const bytes = new Uint8Array(chunks.reduce((n, c) => n + c.length, 0));
+            let off = 0;
+            for (const c of chunks) {
+                bytes.set(c, off);
+                off += c.length;
+            }
+            this.blobs.set(id, bytes);
+        }
+        // a blob result is a Uint8Array for []byte or a Blob for io.Reader
+        fromblob(v) {
+            if (v === null || typeof v !== "object" || !("$blob" in v))
+                return v;
+            const bytes = this.blobs.get(v["$blob"]) || new Uint8Array(0);
+            this.blobs.delete(v["$blob"]);
+            if (v.type === "blob" && typeof Blob !== "undefined")
+                return new Blob([bytes]);
+            return bytes;
+        }
+        // restart the watchdog of a silent connection
+        alive() {
+            clearTimeout(this.watchdog);
+            if (this.heartbeat <= 0)
+                return;
+            this.watchdog = setTimeout(() => {
+                console.log("ws heartbeat timeout at", new Date().toLocaleString());
+                const ws = this.ws;
+                // a half-open socket may never fire close
+                ws.onclose = null;
+                ws.close();
+                this.onclose(null);
+            }, this.heartbeat);
+        }
+        onclose(e) {
+            clearTimeout(this.watchdog);
+            this.root.__active__ = false;
+            this.online = false;
+            if (options.blurOnClose)
+                window.document.body.style.opacity = 0.382;
+            if (e)
+                console.log("ws close at", new Date().toLocaleString(), e);
+            this.lost();
+            this.reconnect();
+        }
         attach() {
             let ws = this.ws;
             let root = this.root;
             root.__active__ = true
             ws.onmessage = this.onmessage.bind(this);
             ws.onopen = e => {
+                ws.send(JSON.stringify({ method: "Gots.hello", params: protocol }));
                 root.__active__ = true
+                if (this.exposed.size > 0)
+                    this.sendexposed("Gots.expose", [...this.exposed.keys()]);
                 if (options.blurOnClose)
                     window.document.body.style.opacity = 1;
             };
             ws.onerror = e => {
                 console.log("ws error at", new Date().toLocaleString(), e);
             };
-            ws.onclose = e => {
-                root.__active__ = false
-                if (options.blurOnClose)
-                    window.document.body.style.opacity = 0.382;
-                console.log("ws close at", new Date().toLocaleString(), e);
-            };
+            ws.onclose = this.onclose.bind(this);
         }
         bind(name) {
             let root = this.root;
             const bindingName = name;
+            // keep pending calls of a reconnected session
+            if (this.bound.has(bindingName))
+                return;
+            this.bound.add(bindingName);
             root[bindingName] = (...args) => __awaiter(this, void 0, void 0, function* () {
                 const me = root[bindingName];
+                for (const arg of args) {
+                    if (isAbortSignal(arg) && arg.aborted)
+                        throw arg.reason || new Error("aborted");
+                }
+                const blobs = [];
                 for (let i = 0; i < args.length; i++) {
+                    // support AbortSignal as a Context
+                    if (isAbortSignal(args[i]))
+                        args[i] = this.fromSignal(args[i]);
                     // support javascript functions as arguments
                     if (typeof args[i] == "function") {
                         let callbacks = me["callbacks"];
@@ -239,13 +648,24 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                             seq: seq
                         };
                     }
+                    else if (isBinary(args[i])) {
+                        const bytes = yield toBytes(args[i]);
+                        if (this.supports("binary")) {
+                            const id = ++this.lastBlobID;
+                            blobs.push({ id, bytes });
+                            args[i] = { $blob: id };
+                        }
+                        else
+                            args[i] = toBase64(bytes);
+                    }
                     else if (args[i] instanceof this.contextType) {
                         const seq = ++this.lastRefID;
                         // js: rewrite input Context().seq = seq
                         args[i].seq = seq;
                         // go: will create Context object from seq and put it in jsclient.refs
                         args[i] = {
-                            seq: seq
+                            seq: seq,
+                            timeout: args[i].timeout()
                         };
                     }
                 }
@@ -276,11 +696,23 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                     }
                 };
                 // binding call phrase 1
-                this.ws.send(JSON.stringify(callMsg));
+                const call = { name: bindingName, seq, msg: callMsg, data: this.encode(callMsg), codec: this.codec, blobs, sent: false };
+                this.inflight.set(bindingName + "#" + seq, call);
+                if (this.online)
+                    call.sent = this.sendcall(call);
+                else if (!this.retry()) {
+                    this.inflight.delete(bindingName + "#" + seq);
+                    this.settle(bindingName, seq, this.fatal || new GotsError({ code: "unavailable", message: "not connected" }));
+                }
                 return promise;
             });
             this.copyBind(bindingName, root);
         }
+        fromSignal(signal) {
+            let ctx = new this.contextType();
+            signal.addEventListener("abort", () => ctx.cancel(), { once: true });
+            return ctx;
+        }
         copyBind(bindingName, root) {
             // copy root["a.b"] to root.a.b
             if (bindingName.indexOf(".") !== -1) {
@@ -306,11 +738,17 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                             seq: this.seq
                         }
                     };
-                    $this.ws.send(JSON.stringify(msg));
+                    $this.send($this.encode(msg));
                 };
                 this.getThis = () => {
                     return $this;
                 };
+                // remaining milliseconds, undefined if there is no deadline
+                this.timeout = () => {
+                    if (this.deadline === undefined)
+                        return undefined;
+                    return Math.max(0, this.deadline - Date.now());
+                };
             }
             this.contextType = Context;
             const TODO = new Context();
@@ -321,6 +759,16 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
                     let ctx = new Context();
                     return [ctx, ctx.cancel];
                 },
+                withTimeout(ms) {
+                    let ctx = new Context();
+                    ctx.deadline = Date.now() + ms;
+                    return [ctx, ctx.cancel];
+                },
+                withDeadline(deadline) {
+                    let ctx = new Context();
+                    ctx.deadline = deadline instanceof Date ? deadline.getTime() : deadline;
+                    return [ctx, ctx.cancel];
+                },
                 background() {
                     return Backgroud;
                 },
@@ -330,6 +778,224 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
             };
         }
     }
+    function errorString(ex) {
+        if (ex === undefined || ex === null)
+            return "unknown error";
+        return ex.toString() || "unknown error";
+    }
+    // MessagePack codec, values are encoded like JSON.stringify but typed arrays are bin
+    class Packer {
+        constructor() {
+            this.buf = new Uint8Array(1024);
+            this.view = new DataView(this.buf.buffer);
+            this.off = 0;
+            this.stack = new Set(); // objects being packed
+        }
+        reserve(n) {
+            if (this.off + n <= this.buf.length)
+                return;
+            let size = this.buf.length * 2;
+            while (size < this.off + n)
+                size *= 2;
+            const buf = new Uint8Array(size);
+            buf.set(this.buf.subarray(0, this.off));
+            this.buf = buf;
+            this.view = new DataView(buf.buffer);
+        }
+        byte(b) {
+            this.reserve(1);
+            this.buf[this.off++] = b;
+        }
+        bytes(b) {
+            this.reserve(b.length);
+            this.buf.set(b, this.off);
+            this.off += b.length;
+        }
+        header(n, fix, fixMax, code8, code16, code32) {
+            this.reserve(5);
+            if (n <= fixMax)
+                this.buf[this.off++] = fix | n;
+            else if (code8 && n <= 0xff) {
+                this.buf[this.off++] = code8;
+                this.buf[this.off++] = n;
+            }
+            else if (n <= 0xffff) {
+                this.buf[this.off] = code16;
+                this.view.setUint16(this.off + 1, n);
+                this.off += 3;
+            }
+            else {
+                this.buf[this.off] = code32;
+                this.view.setUint32(this.off + 1, n);
+                this.off += 5;
+            }
+        }
+        number(v) {
+            this.reserve(9);
+            if (!isFinite(v))
+                this.buf[this.off++] = 0xc0; // null like JSON
+            else if (Number.isInteger(v) && v >= 0 && v <= 0x7f)
+                this.buf[this.off++] = v;
+            else if (Number.isInteger(v) && v < 0 && v >= -32)
+                this.buf[this.off++] = v & 0xff;
+            else if (Number.isInteger(v) && v >= -0x80000000 && v <= 0x7fffffff) {
+                this.buf[this.off] = 0xd2;
+                this.view.setInt32(this.off + 1, v);
+                this.off += 5;
+            }
+            else {
+                this.buf[this.off] = 0xcb;
+                this.view.setFloat64(this.off + 1, v);
+                this.off += 9;
+            }
+        }
+        pack(v, key) {
+            if (v !== null && typeof v === "object" && typeof v.toJSON === "function")
+                v = v.toJSON(key);
+            switch (typeof v) {
+                case "boolean":
+                    this.byte(v ? 0xc3 : 0xc2);
+                    return;
+                case "number":
+                    this.number(v);
+                    return;
+                case "string": {
+                    const b = utf8Encoder.encode(v);
+                    this.header(b.length, 0xa0, 31, 0xd9, 0xda, 0xdb);
+                    this.bytes(b);
+                    return;
+                }
+                case "object": {
+                    if (v === null)
+                        break;
+                    if (v instanceof ArrayBuffer || ArrayBuffer.isView(v)) {
+                        const b = v instanceof ArrayBuffer ? new Uint8Array(v) : new Uint8Array(v.buffer, v.byteOffset, v.byteLength);
+                        this.header(b.length, 0, -1, 0xc4, 0xc5, 0xc6);
+                        this.bytes(b);
+                        return;
+                    }
+                    if (this.stack.has(v))
+                        throw new TypeError("Converting circular structure to msgpack");
+                    this.stack.add(v);
+                    if (Array.isArray(v)) {
+                        this.header(v.length, 0x90, 15, 0, 0xdc, 0xdd);
+                        for (let i = 0; i < v.length; i++)
+                            this.pack(omitted(v[i]) ? null : v[i], String(i));
+                    }
+                    else {
+                        const keys = Object.keys(v).filter(k => !omitted(v[k]));
+                        this.header(keys.length, 0x80, 15, 0, 0xde, 0xdf);
+                        for (const k of keys) {
+                            this.pack(k, "");
+                            this.pack(v[k], k);
+                        }
+                    }
+                    this.stack.delete(v);
+                    return;
+                }
+            }
+            this.byte(0xc0);
+        }
+    }
+    class Unpacker {
+        constructor(buf) {
+            this.buf = buf;
+            this.view = new DataView(buf.buffer, buf.byteOffset, buf.byteLength);
+            this.off = 0;
+        }
+        value() {
+            const c = this.buf[this.off++];
+            if (c <= 0x7f)
+                return c;
+            if (c >= 0xe0)
+                return c - 0x100;
+            if ((c & 0xf0) === 0x80)
+                return this.map(c & 0x0f);
+            if ((c & 0xf0) === 0x90)
+                return this.array(c & 0x0f);
+            if ((c & 0xe0) === 0xa0)
+                return this.str(c & 0x1f);
+            const v = this.view, o = this.off;
+            switch (c) {
+                case 0xc0: return null;
+                case 0xc2: return false;
+                case 0xc3: return true;
+                case 0xc4: this.off += 1; return this.bin(v.getUint8(o));
+                case 0xc5: this.off += 2; return this.bin(v.getUint16(o));
+                case 0xc6: this.off += 4; return this.bin(v.getUint32(o));
+                case 0xca: this.off += 4; return v.getFloat32(o);
+                case 0xcb: this.off += 8; return v.getFloat64(o);
+                case 0xcc: this.off += 1; return v.getUint8(o);
+                case 0xcd: this.off += 2; return v.getUint16(o);
+                case 0xce: this.off += 4; return v.getUint32(o);
+                case 0xcf: this.off += 8; return Number(v.getBigUint64(o));
+                case 0xd0: this.off += 1; return v.getInt8(o);
+                case 0xd1: this.off += 2; return v.getInt16(o);
+                case 0xd2: this.off += 4; return v.getInt32(o);
+                case 0xd3: this.off += 8; return Number(v.getBigInt64(o));
+                case 0xd9: this.off += 1; return this.str(v.getUint8(o));
+                case 0xda: this.off += 2; return this.str(v.getUint16(o));
+                case 0xdb: this.off += 4; return this.str(v.getUint32(o));
+                case 0xdc: this.off += 2; return this.array(v.getUint16(o));
+                case 0xdd: this.off += 4; return this.array(v.getUint32(o));
+                case 0xde: this.off += 2; return this.map(v.getUint16(o));
+                case 0xdf: this.off += 4; return this.map(v.getUint32(o));
+            }
+            throw new Error("msgpack: unsupported type " + c);
+        }
+        str(n) {
+            const s = utf8Decoder.decode(this.buf.subarray(this.off, this.off + n));
+            this.off += n;
+            return s;
+        }
+        bin(n) {
+            const b = this.buf.slice(this.off, this.off + n);
+            this.off += n;
+            return b;
+        }
+        array(n) {
+            const a = new Array(n);
+            for (let i = 0; i < n; i++)
+                a[i] = this.value();
+            return a;
+        }
+        map(n) {
+            const m = {};
+            for (let i = 0; i < n; i++) {
+                const k = this.value();
+                Object.defineProperty(m, k, { value: this.value(), enumerable: true, writable: true, configurable: true });
+            }
+            return m;
+        }
+    }
+    const utf8Encoder = typeof TextEncoder !== "undefined" ? new TextEncoder() : null;
+    const utf8Decoder = typeof TextDecoder !== "undefined" ? new TextDecoder() : null;
+    // values omitted by JSON.stringify
+    function omitted(v) {
+        return v === undefined || typeof v === "function" || typeof v === "symbol";
+    }
+    function isBinary(v) {
+        return v instanceof ArrayBuffer || ArrayBuffer.isView(v) || (typeof Blob !== "undefined" && v instanceof Blob);
+    }
+    function toBytes(v) {
+        return __awaiter(this, void 0, void 0, function* () {
+            if (v instanceof ArrayBuffer)
+                return new Uint8Array(v);
+            if (ArrayBuffer.isView(v))
+                return new Uint8Array(v.buffer, v.byteOffset, v.byteLength);
+            return new Uint8Array(yield v.arrayBuffer());
+        });
+    }
+    // []byte in json
+    function toBase64(bytes) {
+        let text = "";
+        for (let i = 0; i < bytes.length; i += 0x8000)
+            text += String.fromCharCode(...bytes.subarray(i, i + 0x8000));
+        return btoa(text);
+    }
+    function isAbortSignal(v) {
+        return typeof AbortSignal !== "undefined" && v instanceof AbortSignal;
+    }
     function getparam(name, search) {
         search = search === undefined ? window.location.search : search;
         let pair = search
@@ -344,8 +1010,7 @@ var script = `var __awaiter = (this && this.__awaiter) || function (thisArg, _ar
     }
     function main() {
         let host = window.location.host;
-        let ws = new WebSocket((options.tls ? "wss://" : "ws://") + host + options.prefix + "/gots");
-        let gots = new Gots(ws);
+        let gots = new Gots((options.tls ? "wss://" : "ws://") + host + options.prefix + "/gots");
         let api = gots.getapi();
         let exportAPI = () => {
             let name = getparam("name", options.search);
@@ -1,7 +1,9 @@
 package ui
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
@@ -9,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -35,7 +38,8 @@ func (f HTTPServerFunc) Handle(pattern string, handler http.Handler) {
 
 type UIContext struct {
 	Request *http.Request
-	Done    <-chan bool
+	Session *Session
+	Done    <-chan bool // closed when the session ends, a lost connection which is resumed does not close it
 }
 
 type ObjectFactory func(*UIContext) interface{}
@@ -43,9 +47,17 @@ type ObjectFactory func(*UIContext) interface{}
 var defaultServerPath = "/gots"
 
 type ClientOptions struct {
-	BlurOnClose bool
+	BlurOnClose    bool
+	ReconnectDelay time.Duration // max backoff between reconnect attempts, default 10 seconds, negative to never reconnect
+	RetryCalls     bool          // resend calls without a reply after reconnect instead of rejecting them, bindings should be idempotent
 }
 
+var (
+	defaultResumeWindow = 30 * time.Second
+	defaultHeartbeat    = 15 * time.Second
+	defaultPongTimeout  = 10 * time.Second
+)
+
 type FileServer struct {
 	Addr          string
 	ServerPath    string
@@ -54,6 +66,16 @@ type FileServer struct {
 	Auth          func(http.HandlerFunc) http.HandlerFunc
 	HistoryMode   bool
 	ClientOptions *ClientOptions
+	OnPanic       func(binding string, v interface{}, stack []byte) // called after a binding panic is recovered
+	Interceptors  []Interceptor                                     // wrap every binding call, the first one is the outermost
+	OnConnect     func(*Session)                                    // called when a session is ready, not again when it is resumed
+	OnDisconnect  func(*Session)                                    // called when a session ends: closed, or lost and not resumed within ResumeWindow
+	SessionCookie string                                            // cookie name which keeps session state across page reloads, empty for per connection state
+	SessionTTL    time.Duration                                     // how long a cookie state lives after its last session is lost, default 30 minutes
+	ResumeWindow  time.Duration                                     // how long a lost session can be resumed by a reconnecting client, default 30 seconds, negative to disable
+	Heartbeat     time.Duration                                     // ping interval to detect dead clients, default 15 seconds, negative to disable
+	PongTimeout   time.Duration                                     // a client is dead if it does not answer a ping in time, default 10 seconds
+	Codecs        []Codec                                           // message codecs in preference order, JSONCodec is used when none is supported by the client
 
 	root fs.FS // optional for default instance
 
@@ -63,6 +85,14 @@ type FileServer struct {
 
 	bindingNames map[string]bool // for js placeholder
 	bindings     []Bindings
+	policies     map[string][]Policy // binding name -> policies
+
+	sessionsMu   sync.Mutex
+	sessions     map[*Session]bool
+	sessionAdded chan struct{}       // closed and renewed when a session is added
+	states       map[string]*State   // cookie -> state
+	stateKey     []byte              // signs state cookies, so that only issued ids are accepted
+	lost         map[string]*Session // resume token -> session waiting for reconnection
 
 	// local server done
 	wg                   sync.WaitGroup
@@ -85,7 +115,13 @@ func NewFileServer(root fs.FS) *FileServer {
 		es:                   []muxEntry{},
 		server:               &http.Server{Handler: serveMux},
 		bindingNames:         map[string]bool{},
+		policies:             map[string][]Policy{},
 		bindings:             []Bindings{},
+		sessions:             map[*Session]bool{},
+		sessionAdded:         make(chan struct{}),
+		states:               map[string]*State{},
+		stateKey:             []byte(newSessionID()),
+		lost:                 map[string]*Session{},
 		started:              make(chan struct{}),
 		localServerDone:      make(chan struct{}),
 		localServerExitDelay: time.Millisecond * 200,
@@ -236,10 +272,15 @@ func (s *FileServer) handleGots(prefix string, tls bool) {
 	s.es = append(s.es, muxEntry{pattern: prefix + serverPath, h: http.StripPrefix(prefix, websocket.Handler(s.serveClientConn))})
 	s.es = append(s.es, muxEntry{pattern: prefix + getScriptPath(serverPath), h: http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Add("Content-Type", "text/javascript")
+		s.setSessionCookie(w, req, tls)
 		jsQuery := fmt.Sprintf("?%s", req.URL.RawQuery)
 
+		c := &UIContext{Request: req}
 		names := []string{}
 		for name := range s.bindingNames {
+			if s.authorize(name, c) != nil {
+				continue
+			}
 			names = append(names, name)
 		}
 
@@ -252,10 +293,23 @@ func (s *FileServer) handleGots(prefix string, tls bool) {
 		if s.ClientOptions != nil {
 			co := s.ClientOptions
 			jso.BlurOnClose = co.BlurOnClose
+			jso.ReconnectDelay = int(co.ReconnectDelay / time.Millisecond)
+			jso.RetryCalls = co.RetryCalls
 		}
 		clientScript := injectOptions(jso)
 		fmt.Fprint(w, clientScript)
 	}))})
+	s.es = append(s.es, muxEntry{pattern: prefix + getDTSPath(serverPath), h: http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := &UIContext{Request: req}
+		hidden := func(name string) bool { return s.authorize(name, c) != nil }
+		buf := &bytes.Buffer{}
+		if err := writeDTS(buf, s.bindings, hidden); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", "application/typescript")
+		buf.WriteTo(w)
+	}))})
 }
 
 func (s *FileServer) Done() <-chan struct{} {
@@ -277,16 +331,40 @@ func (s *FileServer) collectBindNames(b Bindings) error {
 	for _, name := range b.Names() {
 		s.bindingNames[name] = true
 	}
+	for name, policies := range getPolicies(b) {
+		s.policies[name] = append(s.policies[name], policies...)
+	}
 	return nil
 }
 
-// ready(0) -> started(1+) -> done(0)
+// authorize runs policies of a binding for a session.
+func (s *FileServer) authorize(name string, c *UIContext) error {
+	return authorize(s.policies[name], c)
+}
+
+// authorizeCall is an interceptor which runs policies before every call.
+func (s *FileServer) authorizeCall(call *BindingCall, next Invoker) (interface{}, error) {
+	if err := s.authorize(call.Name, call.Context); err != nil {
+		return nil, err
+	}
+	return next(call)
+}
+
 func (s *FileServer) serveClientConn(ws *websocket.Conn) {
+	s.ServeTransport(newWSTransport(ws), ws.Request())
+}
+
+// ServeTransport serves a gots.js client connected by conn, like a client of the websocket endpoint.
+// r is the request which loaded the client, it carries the resume token and the session cookie.
+// It returns when the client is disconnected.
+//
+// A client without ?protocol in the url of r is version 1 and is served at once:
+// the server sends Gots.bind and Gots.ready, then the client sends Gots.call and gets Gots.ret.
+// Client implements this side in Go, see NewClient.
+//
+// ready(0) -> started(1+) -> done(0)
+func (s *FileServer) ServeTransport(conn Transport, r *http.Request) {
 	s.wg.Add(1)
-	done := make(chan bool)
-	defer func() {
-		close(done)
-	}()
 	defer func() {
 		if s.localServerExitDelay > 0 {
 			<-time.After(s.localServerExitDelay) // support fast page refresh
@@ -302,50 +380,256 @@ func (s *FileServer) serveClientConn(ws *websocket.Conn) {
 		close(s.started)
 	})
 
-	p, err := newPage(ws)
+	interceptors := s.Interceptors
+	if len(s.policies) > 0 {
+		interceptors = append([]Interceptor{s.authorizeCall}, interceptors...)
+	}
+	heartbeat, pongTimeout := s.heartbeat()
+	conf := &connConfig{
+		onPanic:           s.OnPanic,
+		interceptors:      interceptors,
+		heartbeatInterval: heartbeat,
+		heartbeatTimeout:  pongTimeout,
+		codecs:            s.Codecs,
+	}
+	p, err := newPage(conn, conf)
 	if err != nil {
 		log.Printf("attach websocket failed: %v", err)
 	}
-
-	// apply binding
-	binds := map[string]BindingFunc{}
-	collect := func(objName string, target interface{}) {
-		objBinds, err := getBindings(objName, target)
-		if err != nil {
-			log.Printf("get session bindings failed: %v", err)
-			return
-		}
-		for name, f := range objBinds {
-			binds[name] = f
-		}
+	if err := p.jsc.handshake(helloWait(r)); err != nil {
+		log.Printf("handshake failed: %v", err)
+		return
+	}
+	if p.jsc.supports(FeatureHeartbeat) {
+		p.jsc.startHeartbeat()
+	} else {
+		heartbeat = 0
 	}
 
-	c := &UIContext{Request: ws.Request(), Done: done}
-	for _, b := range s.bindings {
-		for name, target := range b.Map(c) {
-			collect(name, target)
+	var sess *Session
+	if p.jsc.supports(FeatureResume) {
+		sess = s.resumeSession(r.URL.Query().Get("resume"))
+	}
+	resumed := sess != nil
+	if !resumed {
+		sess = newSession(r, s.acquireState(r))
+		sess.uictx = &UIContext{Request: r, Session: sess, Done: sess.uidone}
+	}
+	sess.attach(p)
+	s.addSession(sess)
+
+	// apply binding, bindings of a resumed session are reused
+	if !resumed {
+		collect := func(objName string, target interface{}) {
+			objBinds, err := getBindings(objName, target)
+			if err != nil {
+				log.Printf("get session bindings failed: %v", err)
+				return
+			}
+			for name, f := range objBinds {
+				sess.binds[name] = f
+			}
+		}
+		for _, b := range s.bindings {
+			for name, target := range b.Map(sess.uictx) {
+				collect(name, target)
+			}
 		}
 	}
 
-	err = p.bindMap(binds)
+	err = p.bindMap(sess.binds)
 	if err != nil {
 		log.Printf("binding failed: %v", err)
 	}
 
 	// server ready
-	err = p.SetReady()
+	// the client closes a connection silent for heartbeat milliseconds
+	silent := 0
+	if heartbeat > 0 {
+		silent = int((heartbeat + pongTimeout) / time.Millisecond)
+	}
+	err = p.jsc.ready(h{"session": sess.token, "resumed": resumed, "heartbeat": silent})
 	if err != nil {
 		log.Printf("failed to make page ready: %v", err)
 	}
+	if !resumed && s.OnConnect != nil {
+		s.OnConnect(sess)
+	}
 
 	// wait
 	<-p.Done()
+	s.removeSession(sess)
+	s.loseSession(sess, p.jsc.supports(FeatureResume))
+}
+
+// heartbeat returns the ping interval and pong timeout, interval is 0 when heartbeat is disabled.
+func (s *FileServer) heartbeat() (time.Duration, time.Duration) {
+	interval, timeout := s.Heartbeat, s.PongTimeout
+	if interval == 0 {
+		interval = defaultHeartbeat
+	}
+	if interval < 0 {
+		interval = 0
+	}
+	if timeout <= 0 {
+		timeout = defaultPongTimeout
+	}
+	return interval, timeout
+}
+
+// resumeSession takes a lost session by its resume token.
+func (s *FileServer) resumeSession(token string) *Session {
+	if token == "" {
+		return nil
+	}
+	s.sessionsMu.Lock()
+	sess, ok := s.lost[token]
+	delete(s.lost, token)
+	s.sessionsMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.closed || !sess.expire.Stop() {
+		return nil // ending
+	}
+	sess.expire = nil
+	return sess
+}
+
+// loseSession keeps a disconnected session for the resume window.
+func (s *FileServer) loseSession(sess *Session, resumable bool) {
+	window := s.ResumeWindow
+	if window == 0 {
+		window = defaultResumeWindow
+	}
+
+	sess.mu.Lock()
+	if sess.closed || window < 0 || !resumable {
+		sess.mu.Unlock()
+		s.endSession(sess)
+		return
+	}
+	s.sessionsMu.Lock()
+	s.lost[sess.token] = sess
+	s.sessionsMu.Unlock()
+	sess.expire = time.AfterFunc(window, func() {
+		s.endSession(sess)
+	})
+	sess.mu.Unlock()
+}
+
+func (s *FileServer) endSession(sess *Session) {
+	s.sessionsMu.Lock()
+	if s.lost[sess.token] == sess {
+		delete(s.lost, sess.token)
+	}
+	s.sessionsMu.Unlock()
+
+	if !sess.end() {
+		return
+	}
+	s.releaseState(sess.state)
+	if s.OnDisconnect != nil {
+		s.OnDisconnect(sess)
+	}
+}
+
+// Broadcast emits an event to all connected sessions.
+func (s *FileServer) Broadcast(topic string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for _, sess := range s.Sessions() {
+		if err := sess.Emit(topic, json.RawMessage(raw)); err != nil {
+			log.Printf("broadcast %s failed: %v", topic, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileServer) addSession(sess *Session) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	s.sessions[sess] = true
+	close(s.sessionAdded)
+	s.sessionAdded = make(chan struct{})
+}
+
+func (s *FileServer) removeSession(sess *Session) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	delete(s.sessions, sess)
+}
+
+// Sessions returns connected sessions, ordered by connect time.
+// A session whose connection is lost is missing until it is resumed, OnDisconnect is called
+// only when it is not resumed within ResumeWindow.
+func (s *FileServer) Sessions() []*Session {
+	s.sessionsMu.Lock()
+	ret := make([]*Session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		ret = append(ret, sess)
+	}
+	s.sessionsMu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].connected.Before(ret[j].connected)
+	})
+	return ret
+}
+
+// latestSession returns the latest connected session, it waits for one until ctx is done, cancel or server done.
+func (s *FileServer) latestSession(ctx context.Context, cancel <-chan struct{}) (*Session, error) {
+	for {
+		s.sessionsMu.Lock()
+		var latest *Session
+		for sess := range s.sessions {
+			if latest == nil || sess.connected.After(latest.connected) {
+				latest = sess
+			}
+		}
+		added := s.sessionAdded
+		s.sessionsMu.Unlock()
+
+		if latest != nil {
+			return latest, nil
+		}
+		select {
+		case <-added:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-cancel:
+			return nil, fmt.Errorf("window closed")
+		case <-s.Done():
+			return nil, fmt.Errorf("server done")
+		}
+	}
+}
+
+// Session finds a connected session by id, like Sessions a lost session is not found until it is resumed.
+func (s *FileServer) Session(id string) (*Session, bool) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	for sess := range s.sessions {
+		if sess.id == id {
+			return sess, true
+		}
+	}
+	return nil, false
 }
 
 func getScriptPath(serverPath string) string {
 	return fmt.Sprintf("%s.js", serverPath)
 }
 
+func getDTSPath(serverPath string) string {
+	return fmt.Sprintf("%s.d.ts", serverPath)
+}
+
 func BasicAuth(auth func(user string, pass string) bool) func(http.HandlerFunc) http.HandlerFunc {
 	return func(handler http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
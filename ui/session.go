@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Session is a javascript client, it lives across reconnections within FileServer.ResumeWindow.
+type Session struct {
+	id        string
+	request   *http.Request
+	connected time.Time
+	state     *State
+	token     string                 // resume token, only known by the client
+	uictx     *UIContext             // seen by bindings of the session
+	binds     map[string]BindingFunc // rebound to the page of a resumed connection
+	done      chan struct{}
+	uidone    chan bool // UIContext.Done
+	endOnce   sync.Once
+
+	mu     sync.Mutex
+	page   *page       // the current connection
+	closed bool        // closed by server, never resume
+	expire *time.Timer // ends a lost session after the resume window
+}
+
+func newSession(r *http.Request, state *State) *Session {
+	return &Session{
+		id:        newSessionID(),
+		request:   r,
+		connected: time.Now(),
+		state:     state,
+		token:     newSessionID(),
+		binds:     map[string]BindingFunc{},
+		done:      make(chan struct{}),
+		uidone:    make(chan bool),
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ID is a random identifier of the session.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Request is the http request which opened the session.
+func (s *Session) Request() *http.Request {
+	return s.request
+}
+
+// ConnectedAt is the time the session connected.
+func (s *Session) ConnectedAt() time.Time {
+	return s.connected
+}
+
+// State is the key/value store of the session, it is shared by sessions of the same FileServer.SessionCookie.
+func (s *Session) State() *State {
+	return s.state
+}
+
+// Get copies a state value to out, see State.Get.
+func (s *Session) Get(key string, out interface{}) bool {
+	return s.state.Get(key, out)
+}
+
+// Set stores a state value.
+func (s *Session) Set(key string, value interface{}) {
+	s.state.Set(key, value)
+}
+
+// Delete removes a state value.
+func (s *Session) Delete(key string) {
+	s.state.Delete(key)
+}
+
+// attach makes p the current connection.
+func (s *Session) attach(p *page) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.page = p
+	p.uictx = s.uictx
+}
+
+func (s *Session) getPage() *page {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.page
+}
+
+// end closes the session once.
+func (s *Session) end() bool {
+	ended := false
+	s.endOnce.Do(func() {
+		close(s.done)
+		close(s.uidone)
+		ended = true
+	})
+	return ended
+}
+
+// ProtocolVersion is the protocol version negotiated with the current connection.
+func (s *Session) ProtocolVersion() int {
+	version, _ := s.getPage().jsc.protocol()
+	return version
+}
+
+// Features lists optional protocol features negotiated with the current connection.
+func (s *Session) Features() []string {
+	_, features := s.getPage().jsc.protocol()
+	return features
+}
+
+// Codec is the name of the message codec negotiated with the current connection.
+func (s *Session) Codec() string {
+	return s.getPage().jsc.getCodec().Name()
+}
+
+// Latency is the round trip time of the last heartbeat, it is 0 before the first pong.
+func (s *Session) Latency() time.Duration {
+	return s.getPage().jsc.getLatency()
+}
+
+// Eval evaluates javascript in the client, a returned Promise is awaited.
+func (s *Session) Eval(js string) Value {
+	return s.getPage().Eval(js)
+}
+
+// EvalContext is Eval which stops waiting when ctx is done.
+func (s *Session) EvalContext(ctx context.Context, js string) Value {
+	return s.getPage().EvalContext(ctx, js)
+}
+
+// Call invokes a function exposed by Gots.expose(name, fn), or a global function like "window.editor.setText".
+func (s *Session) Call(path string, args ...interface{}) Value {
+	return s.getPage().Call(path, args...)
+}
+
+// CallContext is Call which stops waiting when ctx is done.
+func (s *Session) CallContext(ctx context.Context, path string, args ...interface{}) Value {
+	return s.getPage().CallContext(ctx, path, args...)
+}
+
+// Exposed lists names of functions exposed by Gots.expose.
+func (s *Session) Exposed() []string {
+	return s.getPage().Exposed()
+}
+
+// Emit sends an event to the client, handlers registered with Gots.on(topic, handler) will be called with payload.
+func (s *Session) Emit(topic string, payload interface{}) error {
+	if _, err := json.Marshal(payload); err != nil {
+		return err
+	}
+	return s.getPage().Emit(topic, payload)
+}
+
+// Close disconnects the client and ends the session, the client will not reconnect.
+func (s *Session) Close() {
+	s.mu.Lock()
+	s.closed = true
+	p, expire := s.page, s.expire
+	s.mu.Unlock()
+	if expire != nil {
+		expire.Reset(0) // end a lost session now
+	}
+	p.jsc.send("Gots.close", nil, false)
+	p.Close()
+}
+
+// Done is closed when the session ends, a lost session ends after the resume window.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,191 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveClient connects a pipe client to s, a client with features says Gots.hello first.
+func serveClient(t *testing.T, s *FileServer, features ...string) *testClient {
+	t.Helper()
+	server, conn := Pipe()
+	target := "/gots"
+	if features != nil {
+		target += "?protocol=2"
+	}
+	go s.ServeTransport(server, httptest.NewRequest("GET", target, nil))
+	c := &testClient{Client: newClient(conn, make(chan msg, pipeBuffer)), t: t}
+	t.Cleanup(func() { c.Close() })
+	if features != nil {
+		c.send("Gots.hello", h{"version": ProtocolVersion, "features": features})
+		c.recv("Gots.hello")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Ready(ctx); err != nil {
+		t.Fatalf("ready: %v", err)
+	}
+	return c
+}
+
+type emitParams struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (c *testClient) recvEmit() emitParams {
+	c.t.Helper()
+	m := emitParams{}
+	json.Unmarshal(c.recv("Gots.emit").Params, &m)
+	return m
+}
+
+func TestResumeSession(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	s.ResumeWindow = 20 * time.Millisecond
+	ended := make(chan *Session, 1)
+	s.OnDisconnect = func(sess *Session) { ended <- sess }
+
+	req := httptest.NewRequest("GET", "/gots", nil)
+	sess := newSession(req, s.acquireState(req))
+	sess.Set("step", 1)
+
+	s.loseSession(sess, true)
+	if got := s.resumeSession("bad token"); got != nil {
+		t.Fatalf("resumed by a bad token")
+	}
+	if got := s.resumeSession(sess.token); got != sess {
+		t.Fatalf("session is not resumed")
+	}
+	if got := s.resumeSession(sess.token); got != nil {
+		t.Fatalf("session is resumed twice")
+	}
+
+	s.loseSession(sess, true)
+	select {
+	case got := <-ended:
+		if got != sess {
+			t.Fatalf("ended another session")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("lost session is not ended after the resume window")
+	}
+	select {
+	case <-sess.Done():
+	default:
+		t.Errorf("session is not done")
+	}
+	if got := s.resumeSession(sess.token); got != nil {
+		t.Errorf("ended session is resumed")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	c1, c2 := serveClient(t, s), serveClient(t, s)
+	clients := []*testClient{c1, c2}
+
+	if err := s.Broadcast("tick", h{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range clients {
+		if m := c.recvEmit(); m.Topic != "tick" || string(m.Payload) != `{"n":1}` {
+			t.Errorf("client %d got %s %s", i, m.Topic, m.Payload)
+		}
+	}
+
+	// a session emits to its own client only
+	sessions := s.Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions", len(sessions))
+	}
+	if err := sessions[1].Emit("only", 2); err != nil {
+		t.Fatal(err)
+	}
+	if m := c2.recvEmit(); m.Topic != "only" || string(m.Payload) != "2" {
+		t.Errorf("session emit = %s %s", m.Topic, m.Payload)
+	}
+
+	// payloads which can not be marshaled are not sent
+	if err := s.Broadcast("bad", func() {}); err == nil {
+		t.Errorf("broadcast of a func succeeds")
+	}
+	if err := sessions[0].Emit("bad", make(chan int)); err == nil {
+		t.Errorf("emit of a chan succeeds")
+	}
+
+	// every client got each event exactly once
+	s.Broadcast("end", nil)
+	for i, c := range clients {
+		if m := c.recvEmit(); m.Topic != "end" || string(m.Payload) != "null" {
+			t.Errorf("client %d got %s %s, want end", i, m.Topic, m.Payload)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	s.ResumeWindow = time.Minute
+	connected := make(chan *Session, 2)
+	disconnected := make(chan *Session, 2)
+	s.OnConnect = func(sess *Session) { connected <- sess }
+	s.OnDisconnect = func(sess *Session) { disconnected <- sess }
+
+	serveClient(t, s)
+	first := <-connected
+	// the second client can resume, it reads messages itself to see Gots.close
+	server, conn := Pipe()
+	defer conn.Close()
+	go s.ServeTransport(server, httptest.NewRequest("GET", "/gots?protocol=2", nil))
+	hello, _ := json.Marshal(h{"method": "Gots.hello", "params": h{"version": ProtocolVersion, "features": []string{FeatureResume}}})
+	conn.WriteMessage(false, hello)
+	second := <-connected
+	if features := second.Features(); len(features) != 1 || features[0] != FeatureResume {
+		t.Fatalf("resume is not negotiated")
+	}
+
+	sessions := s.Sessions()
+	if len(sessions) != 2 || sessions[0] != first || sessions[1] != second {
+		t.Fatalf("sessions = %v, want %v %v", sessions, first, second)
+	}
+	if got, ok := s.Session(second.ID()); !ok || got != second {
+		t.Errorf("Session(%s) = %v %v", second.ID(), got, ok)
+	}
+	if _, ok := s.Session("nope"); ok {
+		t.Errorf("unknown session is found")
+	}
+
+	second.Close()
+	closed := false
+	for !closed {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		m := msg{}
+		json.Unmarshal(data, &m)
+		closed = m.Method == "Gots.close"
+	}
+	if !closed {
+		t.Errorf("Gots.close is not sent")
+	}
+	// a closed session is not kept for the resume window
+	select {
+	case sess := <-disconnected:
+		if sess != second {
+			t.Errorf("disconnected another session")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("OnDisconnect is not called after Close")
+	}
+	<-second.Done()
+	if _, ok := s.Session(second.ID()); ok {
+		t.Errorf("closed session is found")
+	}
+	if sessions := s.Sessions(); len(sessions) != 1 || sessions[0] != first {
+		t.Errorf("sessions after close = %v", sessions)
+	}
+}
@@ -0,0 +1,178 @@
+package ui
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaultSessionTTL = 30 * time.Minute
+
+// State is a key/value store shared by sessions of the same cookie, or owned by a single session.
+type State struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+
+	// cookie keyed state only, guarded by FileServer.sessionsMu
+	id     string
+	users  int
+	expire *time.Timer
+}
+
+func newState(id string) *State {
+	return &State{id: id, values: map[string]interface{}{}}
+}
+
+// Get copies value of key to out, which must be a non-nil pointer.
+// It reports false when the key is missing or the value is not assignable to *out.
+func (s *State) Get(key string, out interface{}) bool {
+	s.mu.Lock()
+	v, ok := s.values[key]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return false
+	}
+	if v == nil {
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		return true
+	}
+	value := reflect.ValueOf(v)
+	if !value.Type().AssignableTo(target.Elem().Type()) {
+		return false
+	}
+	target.Elem().Set(value)
+	return true
+}
+
+// Set stores value of key.
+func (s *State) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+// Delete removes key.
+func (s *State) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// Keys returns stored keys in order.
+func (s *State) Keys() []string {
+	s.mu.Lock()
+	ret := make([]string, 0, len(s.values))
+	for key := range s.values {
+		ret = append(ret, key)
+	}
+	s.mu.Unlock()
+	sort.Strings(ret)
+	return ret
+}
+
+// setSessionCookie gives the client a state cookie, so that its sessions share state across page reloads.
+func (s *FileServer) setSessionCookie(w http.ResponseWriter, req *http.Request, tls bool) {
+	if s.SessionCookie == "" {
+		return
+	}
+	if c, err := req.Cookie(s.SessionCookie); err == nil && s.stateID(c.Value) != "" {
+		return
+	}
+	path := s.getPrefix() + "/"
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.SessionCookie,
+		Value:    s.signState(newSessionID()),
+		Path:     path,
+		HttpOnly: true,
+		Secure:   tls,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// signState makes the cookie value of a state id: id.hmac
+func (s *FileServer) signState(id string) string {
+	mac := hmac.New(sha256.New, s.stateKey)
+	mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// stateID returns the state id of a cookie value issued by the server, or "" for other values.
+func (s *FileServer) stateID(value string) string {
+	i := strings.LastIndexByte(value, '.')
+	if i <= 0 {
+		return ""
+	}
+	id := value[:i]
+	if !hmac.Equal([]byte(s.signState(id)), []byte(value)) {
+		return ""
+	}
+	return id
+}
+
+// acquireState returns the state of a new session.
+// A cookie which is not issued by the server gets a state of its own.
+func (s *FileServer) acquireState(req *http.Request) *State {
+	if s.SessionCookie == "" {
+		return newState("")
+	}
+	c, err := req.Cookie(s.SessionCookie)
+	if err != nil {
+		return newState("")
+	}
+	id := s.stateID(c.Value)
+	if id == "" {
+		return newState("")
+	}
+
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	st, ok := s.states[id]
+	if !ok {
+		st = newState(id)
+		s.states[id] = st
+	}
+	st.users++
+	if st.expire != nil {
+		st.expire.Stop()
+		st.expire = nil
+	}
+	return st
+}
+
+// releaseState drops a cookie keyed state when no session used it for SessionTTL.
+func (s *FileServer) releaseState(st *State) {
+	if st.id == "" {
+		return
+	}
+	ttl := s.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	st.users--
+	if st.users > 0 {
+		return
+	}
+	st.expire = time.AfterFunc(ttl, func() { s.dropState(st) })
+}
+
+// dropState forgets a state which is still unused when its ttl expires.
+func (s *FileServer) dropState(st *State) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	if st.users == 0 && s.states[st.id] == st {
+		delete(s.states, st.id)
+	}
+}
@@ -0,0 +1,102 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStateGet(t *testing.T) {
+	st := newState("")
+	st.Set("step", 2)
+	st.Set("name", "wizard")
+
+	var step int
+	if !st.Get("step", &step) || step != 2 {
+		t.Errorf("step = %d", step)
+	}
+	var bad string
+	if st.Get("step", &bad) {
+		t.Errorf("int value assigned to string")
+	}
+	var v interface{}
+	if !st.Get("name", &v) || v != "wizard" {
+		t.Errorf("name = %v", v)
+	}
+	st.Delete("step")
+	if st.Get("step", &step) {
+		t.Errorf("step not deleted")
+	}
+	if keys := st.Keys(); len(keys) != 1 || keys[0] != "name" {
+		t.Errorf("keys = %v", keys)
+	}
+}
+
+func TestSessionCookieState(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	s.SessionCookie = "gots_sid"
+	s.SessionTTL = time.Hour
+
+	w := httptest.NewRecorder()
+	s.setSessionCookie(w, httptest.NewRequest("GET", "/gots.js", nil), false)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "gots_sid" {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	withCookie := func(value string) *http.Request {
+		req := httptest.NewRequest("GET", "/gots", nil)
+		req.AddCookie(&http.Cookie{Name: "gots_sid", Value: value})
+		return req
+	}
+
+	req := withCookie(cookies[0].Value)
+	first := s.acquireState(req)
+	first.Set("step", 1)
+	s.releaseState(first)
+
+	// reload
+	second := s.acquireState(req)
+	if second != first {
+		t.Fatalf("state is not kept across reloads")
+	}
+	s.dropState(second)
+	if s.acquireState(req) != first {
+		t.Errorf("state in use is dropped")
+	}
+	s.releaseState(first)
+	s.releaseState(first)
+
+	// ttl expires
+	s.dropState(first)
+	if third := s.acquireState(req); third == first {
+		t.Errorf("state is not dropped after ttl")
+	}
+	if st := s.acquireState(httptest.NewRequest("GET", "/gots", nil)); st == first || st.id != "" {
+		t.Errorf("state without cookie is shared")
+	}
+}
+
+func TestSessionCookieForged(t *testing.T) {
+	s := NewFileServer(defaultRoot)
+	s.SessionCookie = "gots_sid"
+
+	for _, value := range []string{"chosen-by-attacker", "id.", ".sig", s.signState("id") + "0", NewFileServer(defaultRoot).signState("id")} {
+		req := httptest.NewRequest("GET", "/gots", nil)
+		req.AddCookie(&http.Cookie{Name: "gots_sid", Value: value})
+		if st := s.acquireState(req); st.id != "" {
+			t.Errorf("cookie %q is accepted as state %q", value, st.id)
+		}
+		if len(s.states) != 0 {
+			t.Errorf("cookie %q creates states %v", value, s.states)
+		}
+
+		// a forged cookie is replaced
+		w := httptest.NewRecorder()
+		s.setSessionCookie(w, req, false)
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || s.stateID(cookies[0].Value) == "" {
+			t.Errorf("cookie %q is not replaced: %v", value, cookies)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"log"
+	"reflect"
+)
+
+// stream is a channel result of a binding call.
+// Every element is sent to the client as its own message.
+type stream struct {
+	ch      reflect.Value
+	release cleanups // contexts and callbacks of the call live until the stream ends
+}
+
+// cleanups are deferred by a binding call, they run in reverse order.
+type cleanups []func()
+
+func (c cleanups) run() {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i]()
+	}
+}
+
+type callKey struct {
+	name string
+	seq  int
+}
+
+// close releases the call and drains the channel, so the producer is not blocked forever.
+func (s *stream) close() {
+	s.release.run()
+	go func() {
+		for {
+			if _, ok := s.ch.Recv(); !ok {
+				return
+			}
+		}
+	}()
+}
+
+// isStream reports whether a value of type t is streamed to the client.
+func isStream(t reflect.Type) bool {
+	return t.Kind() == reflect.Chan && t.ChanDir()&reflect.RecvDir != 0
+}
+
+// toResult wraps channel results as stream.
+func toResult(v reflect.Value) interface{} {
+	if isStream(v.Type()) && !v.IsNil() {
+		return &stream{ch: v}
+	}
+	return v.Interface()
+}
+
+// streamResult forwards channel elements until the channel or the client is closed,
+// or the client stops iterating by Gots.cancel.
+//
+// Gots.ret(stream=true) -> Gots.yield * n -> Gots.end
+func (p *jsClient) streamResult(name string, seq int, s *stream) {
+	defer s.close()
+	key := callKey{name: name, seq: seq}
+	stop := make(chan struct{})
+	p.Lock()
+	p.streams[key] = stop
+	p.Unlock()
+	defer p.cancelStream(key)
+
+	_, err := p.send("Gots.ret", h{"name": name, "seq": seq, "result": nil, "error": nil, "stream": true}, false)
+	if err != nil {
+		log.Println("binding call phrase 3 failed:", err)
+		return
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: s.ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.done)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+	}
+	var jsErr interface{}
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen != 0 {
+			return
+		}
+		if !ok {
+			break
+		}
+		if _, err := p.send("Gots.yield", h{"name": name, "seq": seq, "value": v.Interface()}, false); err != nil {
+			jsErr = toError(Errorf(CodeInternal, "marshal result: %v", err))
+			break
+		}
+	}
+	if _, err := p.send("Gots.end", h{"name": name, "seq": seq, "error": jsErr}, false); err != nil {
+		log.Println("stream end failed:", err)
+	}
+}
+
+// cancelStream stops forwarding a stream.
+func (p *jsClient) cancelStream(key callKey) {
+	p.Lock()
+	defer p.Unlock()
+	if stop, ok := p.streams[key]; ok {
+		close(stop)
+		delete(p.streams, key)
+	}
+}
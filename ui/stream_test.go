@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newStreamPage negotiates FeatureStream with the pipe client.
+func newStreamPage(t *testing.T, items map[string]BindingFunc) (*page, *testClient) {
+	p, c := newPipePage(t, items)
+	c.send("Gots.hello", h{"version": ProtocolVersion, "features": []string{FeatureStream}})
+	if err := p.jsc.handshake(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	c.recv("Gots.hello")
+	return p, c
+}
+
+type streamMsg struct {
+	Seq   int             `json:"seq"`
+	Value json.RawMessage `json:"value"`
+	Error *Error          `json:"error"`
+}
+
+func (c *testClient) recvStream(method string) streamMsg {
+	c.t.Helper()
+	m := streamMsg{}
+	json.Unmarshal(c.recv(method).Params, &m)
+	return m
+}
+
+// counter yields 0, 1, 2, ... until ctx is done, or n values if n > 0.
+func counter(stopped chan<- error) func(ctx context.Context, n int) <-chan int {
+	return func(ctx context.Context, n int) <-chan int {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 0; n <= 0 || i < n; i++ {
+				select {
+				case ch <- i:
+				case <-ctx.Done():
+					stopped <- ctx.Err()
+					return
+				}
+			}
+			stopped <- nil
+		}()
+		return ch
+	}
+}
+
+func TestStreamResult(t *testing.T) {
+	stopped := make(chan error, 1)
+	_, c := newStreamPage(t, map[string]BindingFunc{"count": counter(stopped)})
+
+	c.send("Gots.call", h{"name": "count", "seq": 1, "args": []interface{}{h{"seq": 3}, 3}})
+	ret := pipeRet{}
+	json.Unmarshal(c.recv("Gots.ret").Params, &ret)
+	if ret.Error != nil {
+		t.Fatalf("count error = %+v", ret.Error)
+	}
+	for i := 0; i < 3; i++ {
+		if m := c.recvStream("Gots.yield"); string(m.Value) != strconv.Itoa(i) {
+			t.Errorf("yield %d = %s", i, m.Value)
+		}
+	}
+	if m := c.recvStream("Gots.end"); m.Seq != 1 || m.Error != nil {
+		t.Errorf("end = %+v", m)
+	}
+	// the context of the call lives until the stream ends
+	if err := <-stopped; err != nil {
+		t.Errorf("producer stopped by %v", err)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	stopped := make(chan error, 1)
+	_, c := newStreamPage(t, map[string]BindingFunc{"count": counter(stopped)})
+
+	c.send("Gots.call", h{"name": "count", "seq": 1, "args": []interface{}{h{"seq": 3}, 0}})
+	c.recv("Gots.ret")
+	for i := 0; i < 3; i++ {
+		c.recvStream("Gots.yield")
+	}
+	c.send("Gots.cancel", h{"name": "count", "seq": 1})
+	go func() {
+		for range c.unhandled {
+		}
+	}()
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("producer stopped by %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("producer is not canceled by Gots.cancel")
+	}
+}
+
+func TestStreamDisconnect(t *testing.T) {
+	stopped := make(chan error, 1)
+	p, c := newStreamPage(t, map[string]BindingFunc{"count": counter(stopped)})
+
+	c.send("Gots.call", h{"name": "count", "seq": 1, "args": []interface{}{h{"seq": 3}, 0}})
+	c.recv("Gots.ret")
+	c.recvStream("Gots.yield")
+	c.Close()
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("producer stopped by %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("producer is not canceled after the client is closed")
+	}
+	<-p.Done()
+}
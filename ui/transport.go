@@ -0,0 +1,116 @@
+package ui
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// Transport carries messages between the server and a javascript client.
+//
+// Text messages are json, binary messages are blob chunks or messages of a binary codec.
+// gots.js is served over WebSocket, Pipe connects a client in the same process.
+type Transport interface {
+	// ReadMessage blocks until a message is received, it returns io.EOF when the remote end is closed.
+	ReadMessage() (binary bool, data []byte, err error)
+	// WriteMessage is safe for concurrent use.
+	WriteMessage(binary bool, data []byte) error
+	// Close unblocks ReadMessage.
+	Close() error
+}
+
+// frame is a received message.
+type frame struct {
+	binary bool
+	data   []byte
+}
+
+var frameCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		f := v.(*frame)
+		if f.binary {
+			return f.data, websocket.BinaryFrame, nil
+		}
+		return f.data, websocket.TextFrame, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		f := v.(*frame)
+		f.binary = payloadType == websocket.BinaryFrame
+		f.data = data
+		return nil
+	},
+}
+
+// wsTransport is a Transport over a websocket connection.
+type wsTransport struct {
+	ws *websocket.Conn
+}
+
+func newWSTransport(ws *websocket.Conn) Transport {
+	return &wsTransport{ws: ws}
+}
+
+func (t *wsTransport) ReadMessage() (bool, []byte, error) {
+	f := frame{}
+	if err := frameCodec.Receive(t.ws, &f); err != nil {
+		return false, nil, err
+	}
+	return f.binary, f.data, nil
+}
+
+func (t *wsTransport) WriteMessage(binary bool, data []byte) error {
+	return frameCodec.Send(t.ws, &frame{binary: binary, data: data})
+}
+
+func (t *wsTransport) Close() error {
+	return t.ws.Close()
+}
+
+// pipeBuffer is how many messages can be written to a pipe end before it is read.
+const pipeBuffer = 64
+
+// Pipe creates a connected pair of in-process transports, like net.Pipe.
+// Closing either end closes both, reads then return io.EOF and writes return io.ErrClosedPipe.
+func Pipe() (Transport, Transport) {
+	a, b := make(chan frame, pipeBuffer), make(chan frame, pipeBuffer)
+	done := make(chan struct{})
+	once := &sync.Once{}
+	return &pipeEnd{in: a, out: b, done: done, once: once}, &pipeEnd{in: b, out: a, done: done, once: once}
+}
+
+type pipeEnd struct {
+	in   <-chan frame
+	out  chan<- frame
+	done chan struct{} // shared by both ends
+	once *sync.Once
+}
+
+func (p *pipeEnd) ReadMessage() (bool, []byte, error) {
+	select {
+	case f := <-p.in:
+		return f.binary, f.data, nil
+	case <-p.done:
+		return false, nil, io.EOF
+	}
+}
+
+func (p *pipeEnd) WriteMessage(binary bool, data []byte) error {
+	f := frame{binary: binary, data: append([]byte(nil), data...)}
+	select {
+	case <-p.done:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case p.out <- f:
+		return nil
+	case <-p.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (p *pipeEnd) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"io"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe()
+	data := []byte("hi")
+	if err := a.WriteMessage(true, data); err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 'x' // written messages are copied
+	binary, got, err := b.ReadMessage()
+	if err != nil || !binary || string(got) != "hi" {
+		t.Errorf("read = %v %q %v", binary, got, err)
+	}
+
+	b.Close()
+	if _, _, err := a.ReadMessage(); err != io.EOF {
+		t.Errorf("read after close = %v", err)
+	}
+	if err := a.WriteMessage(false, data); err != io.ErrClosedPipe {
+		t.Errorf("write after close = %v", err)
+	}
+}
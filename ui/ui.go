@@ -1,10 +1,12 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync"
 	// "github.com/google/shlex"
 )
 
@@ -13,6 +15,9 @@ type UI interface {
 	Bindable
 	RunMode
 	Add(name string, child UI) // add sub UI
+	Eval(js string) Value      // eval in the local window, it waits for Run to open the window
+	EvalContext(ctx context.Context, js string) Value
+	Done() <-chan struct{} // closed when Run returns, e.g. the local window exits
 }
 
 type Bindable interface {
@@ -33,6 +38,11 @@ type ui struct {
 	confError error
 	bindings  []Bindings
 	children  map[string]UI
+
+	win      Window        // local window, available after ready
+	ready    chan struct{} // closed when Run created the window or server
+	done     chan struct{} // closed when Run returns
+	doneOnce sync.Once
 }
 
 func New(ops ...Option) UI {
@@ -47,7 +57,13 @@ func New(ops ...Option) UI {
 		}
 	}
 
-	app := &ui{conf: conf, confError: confError, children: map[string]UI{}}
+	app := &ui{
+		conf:      conf,
+		confError: confError,
+		children:  map[string]UI{},
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
 	app.useRunMode()
 	app.useSpecialEnvSetting()
 	return app
@@ -85,6 +101,7 @@ func (u *ui) GetBindings() []Bindings {
 }
 
 func (u *ui) Run() error {
+	defer u.doneOnce.Do(func() { close(u.done) })
 	c := u.conf
 
 	if u.confError != nil {
@@ -140,8 +157,20 @@ func (u *ui) Run() error {
 
 	// ** Client Options
 	svr.HistoryMode = u.conf.HistoryMode
+	svr.OnPanic = u.conf.OnPanic
+	svr.Interceptors = u.conf.Interceptors
+	svr.OnConnect = u.conf.OnConnect
+	svr.OnDisconnect = u.conf.OnDisconnect
+	svr.SessionCookie = u.conf.SessionCookie
+	svr.SessionTTL = u.conf.SessionTTL
+	svr.ResumeWindow = u.conf.ResumeWindow
+	svr.Heartbeat = u.conf.Heartbeat
+	svr.PongTimeout = u.conf.PongTimeout
+	svr.Codecs = u.conf.Codecs
 	svr.ClientOptions = &ClientOptions{
-		BlurOnClose: u.conf.BlurOnClose,
+		BlurOnClose:    u.conf.BlurOnClose,
+		ReconnectDelay: u.conf.ReconnectDelay,
+		RetryCalls:     u.conf.RetryCalls,
 	}
 
 	// ** Bindings
@@ -165,6 +194,9 @@ func (u *ui) Run() error {
 		}
 	}
 
+	u.win = win
+	close(u.ready)
+
 	// ** Run
 	switch true {
 	case u.IsLocal():
@@ -197,8 +229,26 @@ func (u *ui) Add(name string, child UI) {
 	u.children[name] = child
 }
 
+func (u *ui) Eval(js string) Value {
+	return u.EvalContext(context.Background(), js)
+}
+
+func (u *ui) EvalContext(ctx context.Context, js string) Value {
+	select {
+	case <-ctx.Done():
+		return value{err: ctx.Err()}
+	case <-u.ready:
+	case <-u.done:
+		return value{err: fmt.Errorf("eval: ui is done")}
+	}
+	if u.win == nil {
+		return value{err: fmt.Errorf("eval: not supported in %s mode", u.runMode)}
+	}
+	return u.win.EvalContext(ctx, js)
+}
+
 func (u *ui) Done() <-chan struct{} {
-	panic(nil)
+	return u.done
 }
 
 //
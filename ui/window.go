@@ -1,6 +1,9 @@
 package ui
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Window interface {
 	Bind(b Bindings) error
@@ -8,6 +11,7 @@ type Window interface {
 	Server() *FileServer
 	SetExitDelay(d time.Duration)
 	Eval(js string) Value
+	EvalContext(ctx context.Context, js string) Value
 	Done() <-chan struct{}
 	Close() error
 }